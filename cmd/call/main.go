@@ -0,0 +1,11 @@
+// Command call is the standalone form of "wif call".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/call"
+)
+
+func main() {
+	cli.Main(call.Command)
+}
@@ -0,0 +1,11 @@
+// Command create-saml is the standalone form of "wif saml create".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/createsaml"
+)
+
+func main() {
+	cli.Main(createsaml.Command)
+}
@@ -0,0 +1,11 @@
+// Command doctor is the standalone form of "wif doctor".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/doctor"
+)
+
+func main() {
+	cli.Main(doctor.Command)
+}
@@ -0,0 +1,11 @@
+// Command inspect is the standalone form of "wif token inspect".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/inspect"
+)
+
+func main() {
+	cli.Main(inspect.Command)
+}
@@ -0,0 +1,11 @@
+// Command k8s-jwks is the standalone form of "wif k8s jwks".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/k8sjwks"
+)
+
+func main() {
+	cli.Main(k8sjwks.Command)
+}
@@ -0,0 +1,12 @@
+// Command manage-subscription is the standalone form of "wif pubsub
+// subscriptions create|describe|delete".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/managesubscription"
+)
+
+func main() {
+	cli.Main(managesubscription.Commands...)
+}
@@ -0,0 +1,12 @@
+// Command manage-topic is the standalone form of "wif pubsub topics
+// create|describe|delete".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/managetopic"
+)
+
+func main() {
+	cli.Main(managetopic.Commands...)
+}
@@ -0,0 +1,11 @@
+// Command probe-permissions is the standalone form of "wif permissions probe".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/probepermissions"
+)
+
+func main() {
+	cli.Main(probepermissions.Command)
+}
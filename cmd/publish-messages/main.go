@@ -0,0 +1,11 @@
+// Command publish-messages is the standalone form of "wif pubsub publish".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/publishmessages"
+)
+
+func main() {
+	cli.Main(publishmessages.Command)
+}
@@ -0,0 +1,11 @@
+// Command pull-messages is the standalone form of "wif pubsub pull".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/pullmessages"
+)
+
+func main() {
+	cli.Main(pullmessages.Command)
+}
@@ -0,0 +1,11 @@
+// Command sign-blob is the standalone form of "wif sign blob".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/signblob"
+)
+
+func main() {
+	cli.Main(signblob.Command)
+}
@@ -0,0 +1,11 @@
+// Command sign-jwt is the standalone form of "wif sign jwt".
+package main
+
+import (
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/signjwt"
+)
+
+func main() {
+	cli.Main(signjwt.Command)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/config"
+	"wif-poc/internal/httpclient"
+)
+
+// The completion scripts ask "wif __complete WORD..." for the candidates of
+// the last word, and fall back to file names when it prints none.
+const (
+	bashCompletion = `# bash completion for wif; load with: source <(wif completion bash)
+_wif() {
+	local IFS=$'\n'
+	COMPREPLY=($("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _wif wif
+`
+	zshCompletion = `# zsh completion for wif; load with: source <(wif completion zsh)
+_wif() {
+	local -a candidates
+	candidates=(${(f)"$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+	if (( ${#candidates} )); then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _wif wif
+`
+	fishCompletion = `# fish completion for wif; load with: wif completion fish | source
+function __wif_complete
+	set -l words (commandline -opc)
+	set -l cmd $words[1]
+	set -e words[1]
+	set -l candidates ($cmd __complete $words (commandline -ct) 2>/dev/null)
+	if test (count $candidates) -eq 0
+		__fish_complete_path (commandline -ct)
+	else
+		printf '%s\n' $candidates
+	end
+end
+complete -c wif -f -a '(__wif_complete)'
+`
+)
+
+// completion prints the completion script of a shell.
+func completion(args []string) {
+	scripts := map[string]string{"bash": bashCompletion, "zsh": zshCompletion, "fish": fishCompletion}
+	if len(args) != 1 || scripts[args[0]] == "" {
+		fmt.Println("Error: Missing or unknown shell")
+		fmt.Println()
+		fmt.Println("Usage:")
+		fmt.Println("  wif completion bash|zsh|fish")
+		fmt.Println()
+		fmt.Println("Examples:")
+		fmt.Println("  source <(wif completion bash)    # in ~/.bashrc")
+		fmt.Println("  source <(wif completion zsh)     # in ~/.zshrc, after compinit")
+		fmt.Println("  wif completion fish | source     # in ~/.config/fish/config.fish")
+		os.Exit(1)
+	}
+	fmt.Print(scripts[args[0]])
+}
+
+// complete prints the candidates for the last of words, the one being
+// typed, one per line.
+func complete(words []string) {
+	if len(words) == 0 {
+		return
+	}
+	before, current := words[:len(words)-1], words[len(words)-1]
+	for _, candidate := range candidates(before, current) {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Println(candidate)
+		}
+	}
+}
+
+// candidates returns the words that may follow before: the next word of a
+// command name, or a flag of the command. It returns nothing where a flag
+// value is expected, so that the shell completes file names.
+func candidates(before []string, current string) []string {
+	if len(before) > 0 && strings.TrimLeft(before[len(before)-1], "-") == "profile" {
+		return profileNames(before)
+	}
+
+	_, network, args, err := splitGlobalFlags(before)
+	if err != nil {
+		// A global flag still waiting for its value.
+		return nil
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "completion":
+			if len(args) == 1 {
+				return []string{"bash", "zsh", "fish"}
+			}
+			return nil
+		case "help":
+			return nextWords(args[1:])
+		}
+	}
+
+	c, rest := lookup(args)
+	if c == nil {
+		if strings.HasPrefix(current, "-") {
+			return flagNames(globalFlags())
+		}
+		next := nextWords(args)
+		if len(args) == 0 {
+			next = append(next, "completion", "help")
+		}
+		return next
+	}
+
+	fs, _ := c.NewFlagSet("wif " + c.Name)
+	if network && fs.Lookup("endpoint-base") == nil {
+		return nil
+	}
+	if len(rest) > 0 && takesValue(fs, rest[len(rest)-1]) {
+		return nil
+	}
+	if current == "" || strings.HasPrefix(current, "-") {
+		return flagNames(fs)
+	}
+	return nil
+}
+
+// nextWords returns the words that follow words in command names.
+func nextWords(words []string) []string {
+	var next []string
+	for _, c := range group(words) {
+		word := strings.Fields(c.Name)[len(words)]
+		if !slices.Contains(next, word) {
+			next = append(next, word)
+		}
+	}
+	return next
+}
+
+// takesValue reports whether arg is a flag of fs whose value is the next
+// argument.
+func takesValue(fs *flag.FlagSet, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+	f := fs.Lookup(strings.TrimLeft(arg, "-"))
+	if f == nil {
+		return false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+// networkFlags returns a set of just the network flags.
+func networkFlags() *flag.FlagSet {
+	var netConfig httpclient.Config
+	fs := flag.NewFlagSet("wif", flag.ContinueOnError)
+	netConfig.RegisterFlags(fs)
+	return fs
+}
+
+// commonFlags returns a set of just the flags every command has.
+func commonFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("wif", flag.ContinueOnError)
+	cli.RegisterCommonFlags(fs)
+	return fs
+}
+
+// globalFlags returns a set of the flags that may come before the command.
+func globalFlags() *flag.FlagSet {
+	fs := networkFlags()
+	cli.RegisterCommonFlags(fs)
+	return fs
+}
+
+// profileNames returns the profiles of the file given by a --config among
+// words, or of the default file.
+func profileNames(words []string) []string {
+	path := os.Getenv(config.EnvConfig)
+	for i, word := range words {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(word, "-"), "=")
+		switch {
+		case name != "config" || !strings.HasPrefix(word, "-"):
+		case hasValue:
+			path = value
+		case i+1 < len(words):
+			path = words[i+1]
+		}
+	}
+	if path == "" {
+		path = config.DefaultPath()
+	}
+	file, err := config.Load(path)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func flagNames(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, "--"+f.Name) })
+	return names
+}
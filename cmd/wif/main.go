@@ -0,0 +1,226 @@
+// Command wif runs every tool of the POC as a subcommand of one binary, e.g.
+// "wif token exchange". The other binaries in cmd/ run the same commands
+// under their original names.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/commands/call"
+	"wif-poc/internal/commands/createjwt"
+	"wif-poc/internal/commands/createsaml"
+	"wif-poc/internal/commands/doctor"
+	"wif-poc/internal/commands/exchangetoken"
+	"wif-poc/internal/commands/generatejwk"
+	"wif-poc/internal/commands/generatekeys"
+	"wif-poc/internal/commands/inspect"
+	"wif-poc/internal/commands/k8sjwks"
+	"wif-poc/internal/commands/listtopics"
+	"wif-poc/internal/commands/managesubscription"
+	"wif-poc/internal/commands/managetopic"
+	"wif-poc/internal/commands/probepermissions"
+	"wif-poc/internal/commands/publishmessages"
+	"wif-poc/internal/commands/pullmessages"
+	"wif-poc/internal/commands/signblob"
+	"wif-poc/internal/commands/signjwt"
+	"wif-poc/internal/httpclient"
+)
+
+// commands are listed in help in this order, which follows the tutorial.
+var commands = slices.Concat(
+	[]*cli.Command{
+		generatekeys.Command,
+		generatejwk.Command,
+		k8sjwks.Command,
+		createjwt.Command,
+		createsaml.Command,
+		exchangetoken.Command,
+		inspect.Command,
+		call.Command,
+		listtopics.Command,
+	},
+	managetopic.Commands,
+	managesubscription.Commands,
+	[]*cli.Command{
+		publishmessages.Command,
+		pullmessages.Command,
+		probepermissions.Command,
+		signblob.Command,
+		signjwt.Command,
+		doctor.Command,
+	},
+)
+
+func main() {
+	global, network, args, err := splitGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Run \"wif help\" for the commands and flags.")
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		printRootHelp(os.Stderr)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "help", "-h", "--help":
+		help(args[1:])
+		return
+	case "completion":
+		completion(args[1:])
+		return
+	case "__complete":
+		complete(args[1:])
+		return
+	}
+
+	c, rest := lookup(args)
+	if c == nil {
+		words := leadingWords(args)
+		if len(group(words)) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: Unknown command %q\n", strings.Join(words, " "))
+			fmt.Fprintln(os.Stderr, "Run \"wif help\" for the commands and flags.")
+			os.Exit(1)
+		}
+		printGroupHelp(os.Stderr, words)
+		os.Exit(1)
+	}
+
+	fs, run := c.NewFlagSet("wif " + c.Name)
+	if network && fs.Lookup("endpoint-base") == nil {
+		fmt.Fprintf(os.Stderr, "Error: wif %s makes no API calls, so network flags don't apply\n", c.Name)
+		os.Exit(1)
+	}
+	fs.Parse(append(global, rest...))
+	run()
+}
+
+// splitGlobalFlags takes the network and common flags given before the
+// command off args. They're passed on to the command as if given after it.
+// network reports whether there were network flags among them.
+func splitGlobalFlags(args []string) (global []string, network bool, rest []string, err error) {
+	flags := globalFlags()
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		if flags.Lookup(name) == nil {
+			return nil, false, nil, fmt.Errorf("unknown flag %s before the command; only network and common flags may come first", args[0])
+		}
+		network = network || httpclient.IsFlag(name)
+		if hasValue || !takesValue(flags, args[0]) {
+			global, args = append(global, args[0]), args[1:]
+			continue
+		}
+		if len(args) < 2 {
+			return nil, false, nil, fmt.Errorf("flag %s needs a value", args[0])
+		}
+		global, args = append(global, args[0], args[1]), args[2:]
+	}
+	return global, network, args, nil
+}
+
+// lookup returns the command named by the first words of args, and the
+// arguments after its name.
+func lookup(args []string) (*cli.Command, []string) {
+	for _, c := range commands {
+		name := strings.Fields(c.Name)
+		if len(args) >= len(name) && slices.Equal(args[:len(name)], name) {
+			return c, args[len(name):]
+		}
+	}
+	return nil, nil
+}
+
+// group returns the commands whose names start with words.
+func group(words []string) []*cli.Command {
+	var matches []*cli.Command
+	for _, c := range commands {
+		name := strings.Fields(c.Name)
+		if len(name) > len(words) && slices.Equal(name[:len(words)], words) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// leadingWords returns the arguments before the first flag.
+func leadingWords(args []string) []string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return args[:i]
+		}
+	}
+	return args
+}
+
+// help prints the help of a command or a group of commands.
+func help(words []string) {
+	if len(words) == 0 {
+		printRootHelp(os.Stdout)
+		return
+	}
+	if c, rest := lookup(words); c != nil && len(rest) == 0 {
+		fs, _ := c.NewFlagSet("wif " + c.Name)
+		fs.SetOutput(os.Stdout)
+		fs.Usage()
+		return
+	}
+	if len(group(words)) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: Unknown command %q\n", strings.Join(words, " "))
+		fmt.Fprintln(os.Stderr, "Run \"wif help\" for the commands and flags.")
+		os.Exit(1)
+	}
+	printGroupHelp(os.Stdout, words)
+}
+
+func printRootHelp(w io.Writer) {
+	fmt.Fprintln(w, "wif runs the GCP Workload Identity Federation POC tools")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  wif [network and common flags] <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	printCommands(tw, commands)
+	fmt.Fprintf(tw, "  completion bash|zsh|fish\tPrint a shell completion script\n")
+	fmt.Fprintf(tw, "  help [command]\tShow the help of a command\n")
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Network flags, for every command that calls an API, before or after the command:")
+	cli.PrintFlags(w, networkFlags())
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Common flags, for every command, before or after the command:")
+	cli.PrintFlags(w, commonFlags())
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags not given on the command line come from WIF_<FLAG> environment variables")
+	fmt.Fprintln(w, "(e.g. WIF_POOL_ID), then from the profile; see \"Profiles\" in the README.")
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run \"wif help <command>\" or \"wif <command> --help\" for the flags of a command.")
+}
+
+func printGroupHelp(w io.Writer, words []string) {
+	prefix := "wif " + strings.Join(words, " ")
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintf(w, "  %s <command> [flags]\n", prefix)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	printCommands(tw, group(words))
+	tw.Flush()
+}
+
+// printCommands writes a "name  summary" row per command to tw.
+func printCommands(tw *tabwriter.Writer, list []*cli.Command) {
+	for _, c := range list {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Summary)
+	}
+}
@@ -2,4 +2,4 @@ module wif-poc
 
 go 1.25.0
 
-require github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+require github.com/golang-jwt/jwt/v5 v5.3.0
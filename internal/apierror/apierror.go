@@ -0,0 +1,238 @@
+// Package apierror decodes error responses from the STS, IAM Credentials and
+// other Google APIs into typed errors with remediation hints.
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kind classifies an error by its most likely root cause.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindInvalidIssuer
+	KindAudienceMismatch
+	KindSignature
+	KindExpiredToken
+	KindConditionRejected
+	KindPoolNotFound
+	KindMissingWorkloadIdentityUser
+	KindPermissionDenied
+	KindAPIDisabled
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindInvalidIssuer:
+		return "invalid issuer"
+	case KindAudienceMismatch:
+		return "audience mismatch"
+	case KindSignature:
+		return "signature verification failed"
+	case KindExpiredToken:
+		return "token expired"
+	case KindConditionRejected:
+		return "attribute condition rejected"
+	case KindPoolNotFound:
+		return "pool or provider not found"
+	case KindMissingWorkloadIdentityUser:
+		return "missing workloadIdentityUser"
+	case KindPermissionDenied:
+		return "permission denied"
+	case KindAPIDisabled:
+		return "API disabled"
+	default:
+		return "unknown"
+	}
+}
+
+// Detail is one entry of a Google error's details list, typically a
+// google.rpc.ErrorInfo.
+type Detail struct {
+	Type     string            `json:"@type"`
+	Reason   string            `json:"reason"`
+	Domain   string            `json:"domain"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// Error is a decoded API error response.
+type Error struct {
+	API        string // human-readable API name, e.g. "STS"
+	StatusCode int
+	Code       string // OAuth "error" or Google "error.status"
+	Message    string // OAuth "error_description" or Google "error.message"
+	Details    []Detail
+	Kind       Kind
+	Body       string // raw response body
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("%s API error (status %d): %s", e.API, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("%s API error (status %d): %s: %s", e.API, e.StatusCode, e.Code, e.Message)
+}
+
+// Permission returns the IAM permission named in an ErrorInfo detail, if any.
+func (e *Error) Permission() string {
+	for _, d := range e.Details {
+		if p := d.Metadata["permission"]; p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// Hint returns a remediation hint for the error's Kind, or "" when none
+// applies.
+func (e *Error) Hint() string {
+	switch e.Kind {
+	case KindInvalidIssuer:
+		return "The token's iss claim doesn't match the provider's --issuer-uri. Compare create-jwt --issuer with:\n" +
+			"  gcloud iam workload-identity-pools providers describe PROVIDER_ID --workload-identity-pool=POOL_ID --location=global"
+	case KindAudienceMismatch:
+		return "The token's aud claim is not in the provider's --allowed-audiences. Either mint the token with a listed audience\n" +
+			"or, when no audiences are configured, use https://iam.googleapis.com/projects/NUM/locations/global/workloadIdentityPools/POOL/providers/PROVIDER."
+	case KindSignature:
+		return "The signature could not be verified with the provider's JWKS: the JWKS is not configured or unreachable,\n" +
+			"it holds a different public key, or the JWT's kid doesn't match any key. Regenerate it with generate-jwk and update the provider."
+	case KindExpiredToken:
+		return "The subject token has expired (or was issued too long ago, or its iat is in the future). Mint a new one with create-jwt and check the local clock."
+	case KindConditionRejected:
+		return "The provider's --attribute-condition rejected the token: it's missing a required claim or the condition\n" +
+			"doesn't match the token's claims. Compare the condition with the claims in the token."
+	case KindPoolNotFound:
+		return "The pool or provider in the audience doesn't exist or is disabled. Check --project-number (not the project ID),\n" +
+			"--pool-id and --provider-id with: gcloud iam workload-identity-pools providers list --workload-identity-pool=POOL_ID --location=global"
+	case KindMissingWorkloadIdentityUser:
+		return "The federated principal may not impersonate the service account. Grant roles/iam.workloadIdentityUser to the pool's principalSet:\n" +
+			"  gcloud iam service-accounts add-iam-policy-binding SA_EMAIL --role=roles/iam.workloadIdentityUser \\\n" +
+			"    --member=\"principalSet://iam.googleapis.com/projects/NUM/locations/global/workloadIdentityPools/POOL_ID/*\"\n" +
+			"New bindings can take several minutes to propagate. Check: gcloud iam service-accounts get-iam-policy SA_EMAIL"
+	case KindPermissionDenied:
+		p := e.Permission()
+		switch {
+		case strings.HasPrefix(p, "iam.serviceAccounts.sign"):
+			return fmt.Sprintf("The caller lacks the %s permission. Grant roles/iam.serviceAccountTokenCreator on the service account\n", p) +
+				"to the caller (the service account itself when signing with its own access token):\n" +
+				"  gcloud iam service-accounts add-iam-policy-binding SA_EMAIL --role=roles/iam.serviceAccountTokenCreator \\\n" +
+				"    --member=\"serviceAccount:SA_EMAIL\""
+		case p != "":
+			return fmt.Sprintf("The caller lacks the %s permission. Grant a role that includes it to the service account.", p)
+		}
+		return "The caller lacks a required permission. Check the service account's roles on the resource."
+	case KindAPIDisabled:
+		return "The API is not enabled on the project. Enable it with: gcloud services enable SERVICE --project=PROJECT_ID"
+	default:
+		return ""
+	}
+}
+
+// oauthError is the RFC 6749 error format returned by STS.
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// googleError is the google.rpc.Status envelope returned by Google APIs.
+type googleError struct {
+	Error struct {
+		Code    int      `json:"code"`
+		Message string   `json:"message"`
+		Status  string   `json:"status"`
+		Details []Detail `json:"details"`
+	} `json:"error"`
+}
+
+// Parse decodes an error response body from api. Bodies in neither the OAuth
+// nor the Google format are kept verbatim.
+func Parse(api string, statusCode int, body []byte) *Error {
+	e := &Error{
+		API:        api,
+		StatusCode: statusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+
+	var g googleError
+	if err := json.Unmarshal(body, &g); err == nil && (g.Error.Status != "" || g.Error.Message != "") {
+		e.Code = g.Error.Status
+		e.Message = g.Error.Message
+		e.Details = g.Error.Details
+	} else {
+		var o oauthError
+		if err := json.Unmarshal(body, &o); err == nil && o.Error != "" {
+			e.Code = o.Error
+			e.Message = o.ErrorDescription
+		}
+	}
+
+	e.Kind = classify(e)
+	return e
+}
+
+func classify(e *Error) Kind {
+	msg := strings.ToLower(e.Message)
+
+	for _, d := range e.Details {
+		if d.Reason == "SERVICE_DISABLED" || d.Reason == "API_DISABLED" {
+			return KindAPIDisabled
+		}
+	}
+
+	switch {
+	case e.Code == "invalid_target":
+		return KindPoolNotFound
+	case strings.Contains(msg, "attribute condition"):
+		return KindConditionRejected
+	case e.Code == "invalid_grant" && signatureRejected(msg):
+		return KindSignature
+	case strings.Contains(msg, "issuer"):
+		return KindInvalidIssuer
+	case strings.Contains(msg, "audience") && (strings.Contains(msg, "match") || strings.Contains(msg, "allowed")):
+		return KindAudienceMismatch
+	case strings.Contains(msg, "expired"), strings.Contains(msg, "in the future"), strings.Contains(msg, "stale"):
+		return KindExpiredToken
+	case strings.Contains(msg, "has not been used"), strings.Contains(msg, "is disabled") && strings.Contains(msg, "api"):
+		return KindAPIDisabled
+	case (strings.Contains(msg, "pool") || strings.Contains(msg, "provider")) &&
+		(strings.Contains(msg, "not exist") || strings.Contains(msg, "not found") || strings.Contains(msg, "disabled")):
+		return KindPoolNotFound
+	}
+
+	if e.StatusCode == http.StatusForbidden || e.Code == "PERMISSION_DENIED" {
+		// signBlob and signJwt need roles/iam.serviceAccountTokenCreator,
+		// which workloadIdentityUser doesn't include.
+		signing := strings.Contains(msg, "signblob") || strings.Contains(msg, "signjwt") ||
+			strings.HasPrefix(e.Permission(), "iam.serviceAccounts.sign")
+		if e.API == "IAM Credentials" && !signing && (strings.Contains(msg, "getaccesstoken") || strings.Contains(msg, "getopenidtoken") ||
+			strings.Contains(e.Permission(), "iam.serviceAccounts.") || strings.Contains(msg, "iam.serviceaccounts")) {
+			return KindMissingWorkloadIdentityUser
+		}
+		return KindPermissionDenied
+	}
+	return KindUnknown
+}
+
+// signatureRejected reports whether an STS invalid_grant message is about
+// the subject token's signature or keys. Whole phrases and words are
+// matched, so that e.g. "signBlob signature" elsewhere doesn't qualify.
+func signatureRejected(msg string) bool {
+	for _, phrase := range []string{"jwt signature", "invalid signature", "signature verification", "verify signature", "signature is invalid"} {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	words := strings.FieldsFunc(msg, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	for _, w := range words {
+		if w == "kid" || w == "jwk" || w == "jwks" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package apierror
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		api    string
+		status int
+		body   string
+		want   Kind
+	}{
+		{
+			name:   "pool or provider missing",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_target","error_description":"The target service indicated by the \"audience\" parameters is invalid. This might either be because the pool or provider is disabled or deleted or because it doesn't exist."}`,
+			want:   KindPoolNotFound,
+		},
+		{
+			name:   "audience mismatch",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"The audience in ID Token [gcp-workload-identity] does not match the expected audience https://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider."}`,
+			want:   KindAudienceMismatch,
+		},
+		{
+			name:   "issuer mismatch",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"The issuer in ID Token [https://other.example.com] does not match the expected issuer [https://idp.example.com]."}`,
+			want:   KindInvalidIssuer,
+		},
+		{
+			name:   "invalid signature",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"Invalid JWT signature."}`,
+			want:   KindSignature,
+		},
+		{
+			name:   "unknown kid",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"The kid \"key-2\" in the ID Token header is not found in the provider's JWKs."}`,
+			want:   KindSignature,
+		},
+		{
+			name:   "expired",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"The ID Token has expired."}`,
+			want:   KindExpiredToken,
+		},
+		{
+			name:   "issued too long ago",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"ID Token issued at 1700000000 is stale to sign-in."}`,
+			want:   KindExpiredToken,
+		},
+		{
+			name:   "attribute condition",
+			api:    "STS",
+			status: 400,
+			body:   `{"error":"unauthorized_client","error_description":"The given credential is rejected by the attribute condition."}`,
+			want:   KindConditionRejected,
+		},
+		{
+			name:   "missing workloadIdentityUser",
+			api:    "IAM Credentials",
+			status: 403,
+			body: `{"error":{"code":403,"message":"Permission 'iam.serviceAccounts.getAccessToken' denied on resource (or it may not exist).","status":"PERMISSION_DENIED",` +
+				`"details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"IAM_PERMISSION_DENIED","domain":"iam.googleapis.com","metadata":{"permission":"iam.serviceAccounts.getAccessToken"}}]}}`,
+			want: KindMissingWorkloadIdentityUser,
+		},
+		{
+			name:   "missing workloadIdentityUser for an ID token",
+			api:    "IAM Credentials",
+			status: 403,
+			body:   `{"error":{"code":403,"message":"Permission 'iam.serviceAccounts.getOpenIdToken' denied on resource (or it may not exist).","status":"PERMISSION_DENIED"}}`,
+			want:   KindMissingWorkloadIdentityUser,
+		},
+		{
+			name:   "signBlob without Token Creator",
+			api:    "IAM Credentials",
+			status: 403,
+			body: `{"error":{"code":403,"message":"Permission 'iam.serviceAccounts.signBlob' denied on resource (or it may not exist).","status":"PERMISSION_DENIED",` +
+				`"details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"IAM_PERMISSION_DENIED","domain":"iam.googleapis.com","metadata":{"permission":"iam.serviceAccounts.signBlob"}}]}}`,
+			want: KindPermissionDenied,
+		},
+		{
+			name:   "API disabled",
+			api:    "IAM Credentials",
+			status: 403,
+			body: `{"error":{"code":403,"message":"IAM Service Account Credentials API has not been used in project 123 before or it is disabled. Enable it by visiting https://console.developers.google.com/apis/api/iamcredentials.googleapis.com/overview?project=123 then retry.","status":"PERMISSION_DENIED",` +
+				`"details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"SERVICE_DISABLED","domain":"googleapis.com","metadata":{"service":"iamcredentials.googleapis.com","consumer":"projects/123"}}]}}`,
+			want: KindAPIDisabled,
+		},
+		{
+			name:   "Pub/Sub permission denied",
+			api:    "Pub/Sub",
+			status: 403,
+			body:   `{"error":{"code":403,"message":"User not authorized to perform this action.","status":"PERMISSION_DENIED"}}`,
+			want:   KindPermissionDenied,
+		},
+		{
+			name:   "Pub/Sub not found",
+			api:    "Pub/Sub",
+			status: 404,
+			body:   `{"error":{"code":404,"message":"Resource not found (resource=wif-test).","status":"NOT_FOUND"}}`,
+			want:   KindUnknown,
+		},
+		{
+			name:   "bad request about a signature elsewhere",
+			api:    "IAM Credentials",
+			status: 400,
+			body:   `{"error":{"code":400,"message":"Request contains an invalid argument: the signBlob payload signature must be base64.","status":"INVALID_ARGUMENT"}}`,
+			want:   KindUnknown,
+		},
+		{
+			name:   "HTML from a proxy",
+			api:    "STS",
+			status: 502,
+			body:   "<html><body>502 Bad Gateway</body></html>",
+			want:   KindUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Parse(tt.api, tt.status, []byte(tt.body))
+			if e.Kind != tt.want {
+				t.Errorf("Kind = %s, want %s (code %q, message %q)", e.Kind, tt.want, e.Code, e.Message)
+			}
+			if tt.want != KindUnknown && e.Hint() == "" {
+				t.Errorf("no hint for %s", e.Kind)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	e := Parse("IAM Credentials", 403, []byte(`{"error":{"code":403,"message":"Permission 'iam.serviceAccounts.signJwt' denied on resource (or it may not exist).","status":"PERMISSION_DENIED",`+
+		`"details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"IAM_PERMISSION_DENIED","domain":"iam.googleapis.com","metadata":{"permission":"iam.serviceAccounts.signJwt"}}]}}`))
+	if e.Code != "PERMISSION_DENIED" || e.Permission() != "iam.serviceAccounts.signJwt" {
+		t.Errorf("Code %q, Permission %q", e.Code, e.Permission())
+	}
+	if !strings.Contains(e.Hint(), "roles/iam.serviceAccountTokenCreator") {
+		t.Errorf("Hint() = %q, want the Token Creator role", e.Hint())
+	}
+	if want := "IAM Credentials API error (status 403): PERMISSION_DENIED: Permission 'iam.serviceAccounts.signJwt' denied on resource (or it may not exist)."; e.Error() != want {
+		t.Errorf("Error() = %q, want %q", e.Error(), want)
+	}
+
+	e = Parse("STS", 400, []byte(`{"error":"invalid_request","error_description":"Invalid value for \"subject_token_type\"."}`))
+	if e.Code != "invalid_request" || e.Message != `Invalid value for "subject_token_type".` {
+		t.Errorf("OAuth error parsed as code %q, message %q", e.Code, e.Message)
+	}
+
+	e = Parse("STS", 502, []byte("  Bad Gateway\n"))
+	if e.Error() != "STS API error (status 502): Bad Gateway" {
+		t.Errorf("Error() = %q, want the body verbatim", e.Error())
+	}
+}
@@ -0,0 +1,150 @@
+// Package cli holds the pieces the commands share around their main
+// function: the command definition and help, the narration writer, reading
+// and writing tokens (with - for stdin and stdout), reporting errors and
+// common flag types.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"wif-poc/internal/apierror"
+)
+
+// Log receives the tutorial narration: step banners, progress, ✓ lines and
+// next steps. It's stderr, so that stdout carries only results, and is
+// discarded with --quiet or when a machine-readable format is selected.
+var Log io.Writer = os.Stderr
+
+// Stdio is the path that stands for stdin as an input and stdout as an
+// output, so that commands can be piped without tokens touching the disk.
+const Stdio = "-"
+
+// stdinRead is set once an input has consumed stdin.
+var stdinRead bool
+
+// ReadFile reads the file at path, or stdin when path is Stdio. Stdin can
+// only be read once, so a second Stdio input is an error.
+func ReadFile(path string) ([]byte, error) {
+	if path != Stdio {
+		return os.ReadFile(path)
+	}
+	if stdinRead {
+		return nil, errors.New("stdin is already read by another input; only one input can be -")
+	}
+	stdinRead = true
+	return io.ReadAll(os.Stdin)
+}
+
+// WriteFile writes data to the file at path, readable by the owner only
+// since it's usually a credential, or to stdout when path is Stdio. An
+// existing file is made owner-only before it's written.
+func WriteFile(path string, data []byte) error {
+	if path == Stdio {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// InputName returns an input path as the narration shows it.
+func InputName(path string) string {
+	if path == Stdio {
+		return "stdin"
+	}
+	return path
+}
+
+// OutputName returns an output path as the narration shows it.
+func OutputName(path string) string {
+	if path == Stdio {
+		return "stdout"
+	}
+	return path
+}
+
+// ReadAccessToken reads an access token file written by exchange-token, or
+// stdin for Stdio. An empty path yields an empty token, for callers that
+// allow running without credentials (e.g. against the Pub/Sub emulator).
+func ReadAccessToken(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// PrintError writes err to w, followed by the cause and remediation hint
+// when err wraps an API error.
+func PrintError(w io.Writer, err error) {
+	fmt.Fprintf(w, "Error: %v\n", err)
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		fmt.Fprintf(w, "  Cause: %s\n", apiErr.Kind)
+		if hint := apiErr.Hint(); hint != "" {
+			fmt.Fprintf(w, "\nHint:\n%s\n", hint)
+		}
+	}
+}
+
+// Headers collects repeated "Name: value" header flags.
+type Headers []string
+
+func (h *Headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *Headers) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header %q must be in \"Name: value\" form", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// KeyValues collects repeated key=value flags, such as labels or message
+// attributes.
+type KeyValues map[string]string
+
+func (kv KeyValues) String() string {
+	return FormatKeyValues(kv)
+}
+
+func (kv KeyValues) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("%q must be in key=value form", value)
+	}
+	kv[key] = val
+	return nil
+}
+
+// FormatKeyValues renders a map as sorted, comma-separated key=value pairs.
+func FormatKeyValues(kv map[string]string) string {
+	pairs := make([]string, 0, len(kv))
+	for key, value := range kv {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,320 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"wif-poc/internal/config"
+	"wif-poc/internal/httpclient"
+)
+
+// Command is one subcommand of the wif binary. The standalone binaries in
+// cmd/ run the same Command under their original names.
+type Command struct {
+	Name     string   // words after "wif", e.g. "pubsub topics list"
+	Binary   string   // standalone binary and action, e.g. "list-topics" or "manage-topic create"
+	Summary  string   // one line, for command lists
+	Synopsis []string // argument patterns, shown after the program name
+	Notes    []string // paragraphs printed after the flags
+	Examples []string // argument lists, shown after the program name
+
+	// Env names the environment variables the command itself reads flag
+	// defaults from, where they differ from WIF_<FLAG>.
+	Env map[string]string
+
+	// Interspersed lets flags follow the arguments, as curl does; they
+	// are parsed before any default is applied, so --profile and --config
+	// work anywhere on the command line.
+	Interspersed bool
+
+	// Setup registers the command's flags on fs and returns the function
+	// that runs the command once fs has been parsed.
+	Setup func(fs *flag.FlagSet) func()
+}
+
+// NewFlagSet returns the command's flags, registered on a set whose usage
+// is the command's help, and the function that runs the command once the
+// set has been parsed. prog is how the user invoked the command.
+//
+// Before the command runs, flags not given on the command line are taken
+// from the environment (WIF_<FLAG>, e.g. WIF_POOL_ID) and then from the
+// selected profile, so the precedence is flag > environment > profile >
+// default. Flags whose meaning differs between commands are only taken from
+// profile keys naming the command, e.g. create-jwt.audience.
+func (c *Command) NewFlagSet(prog string) (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet(prog, flag.ExitOnError)
+	run := c.Setup(fs)
+	common := RegisterCommonFlags(fs)
+	fs.Usage = func() { c.PrintHelp(fs.Output(), fs) }
+	return fs, func() {
+		if c.Interspersed {
+			parseInterspersed(fs)
+		}
+		if err := c.applyDefaults(fs, *common.Config, *common.Profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *common.Quiet {
+			Log = io.Discard
+		}
+		run()
+	}
+}
+
+// parseInterspersed parses the flags left among fs's arguments after the
+// first one, so that fs.Args() holds only the arguments.
+func parseInterspersed(fs *flag.FlagSet) {
+	var args []string
+	for fs.NArg() > 0 {
+		args = append(args, fs.Arg(0))
+		rest := fs.Args()[1:]
+		if len(rest) > 0 && rest[0] == "--" {
+			args = append(args, rest[1:]...)
+			break
+		}
+		fs.Parse(rest)
+	}
+	// "--" ends the flags, so every argument is kept as is.
+	fs.Parse(append([]string{"--"}, args...))
+}
+
+// CommonFlags are the flags every command has.
+type CommonFlags struct {
+	Config  *string
+	Profile *string
+	Quiet   *bool
+}
+
+// RegisterCommonFlags adds --config, --profile and --quiet to fs.
+func RegisterCommonFlags(fs *flag.FlagSet) CommonFlags {
+	return CommonFlags{
+		Config:  fs.String("config", "", "Profiles file (env "+config.EnvConfig+", default "+config.DefaultPath()+")"),
+		Profile: fs.String("profile", "", "Profile to take flags not given here from (env "+config.EnvProfile+", default the file's default-profile)"),
+		Quiet:   fs.Bool("quiet", false, "Don't print the tutorial text; only results and errors"),
+	}
+}
+
+// IsCommonFlag reports whether name is one of the flags every command has.
+func IsCommonFlag(name string) bool {
+	return name == "config" || name == "profile" || name == "quiet"
+}
+
+// perCommandFlags are the flags whose meaning differs between commands,
+// e.g. --output is the JWT for create-jwt but the access token for
+// exchange-token, and --audience is the provider for create-jwt but an API
+// URL for sign-jwt, so one WIF_<FLAG> or profile value can't serve them all.
+// --print means the same everywhere but drops the tutorial text, so a shared
+// value would silence every command.
+var perCommandFlags = map[string]bool{
+	"output":            true,
+	"print":             true,
+	"input":             true,
+	"token-input":       true,
+	"audience":          true,
+	"subject":           true,
+	"jwks-output":       true,
+	"ack-deadline":      true,
+	"message-retention": true,
+}
+
+// profileKey returns the profile key that sets the flag for this command
+// alone, e.g. "create-jwt.audience" or "manage-subscription.ack-deadline".
+func (c *Command) profileKey(flagName string) string {
+	binary, _, _ := strings.Cut(c.Binary, " ")
+	return binary + "." + flagName
+}
+
+// applyDefaults sets the flags not given on the command line from the
+// environment or the profile.
+func (c *Command) applyDefaults(fs *flag.FlagSet, configPath, profileName string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	profile, err := config.LoadProfile(configPath, profileName)
+	if err != nil {
+		return err
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || f.Name == "config" || f.Name == "profile" {
+			return
+		}
+		perCommand := perCommandFlags[f.Name]
+
+		// Flags whose default already comes from an environment variable
+		// keep it over the profile.
+		if env := c.ownEnv(f.Name); env != "" {
+			if os.Getenv(env) != "" {
+				return
+			}
+		} else if value := os.Getenv(config.EnvName(f.Name)); value != "" && !perCommand {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", config.EnvName(f.Name), setErr)
+			}
+			return
+		}
+
+		key := c.profileKey(f.Name)
+		values, scoped := profile[key]
+		if !scoped {
+			if perCommand {
+				return
+			}
+			key, values = f.Name, profile[f.Name]
+		}
+		for _, value := range values {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s in profile: %w", key, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// ownEnv returns the environment variable the flag's default is read from
+// when the flag is registered, if any.
+func (c *Command) ownEnv(name string) string {
+	if env := c.Env[name]; env != "" {
+		return env
+	}
+	return httpclient.EnvName(name)
+}
+
+// Run parses args and runs the command.
+func (c *Command) Run(prog string, args []string) {
+	fs, run := c.NewFlagSet(prog)
+	fs.Parse(args)
+	run()
+}
+
+// PrintHelp writes the command's summary, usage, flags, notes and examples.
+// Network flags are listed in a section of their own.
+func (c *Command) PrintHelp(w io.Writer, fs *flag.FlagSet) {
+	prog := fs.Name()
+	fmt.Fprintln(w, c.Summary)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	for _, synopsis := range c.Synopsis {
+		fmt.Fprintf(w, "  %s %s\n", prog, synopsis)
+	}
+
+	// k8s-jwks has a --ca-file of its own, so only commands with all the
+	// network flags get the section.
+	hasNetwork := fs.Lookup("endpoint-base") != nil
+	var own, network, common []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		switch {
+		case hasNetwork && httpclient.IsFlag(f.Name):
+			network = append(network, f)
+		case IsCommonFlag(f.Name):
+			common = append(common, f)
+		default:
+			own = append(own, f)
+		}
+	})
+	if len(own) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Flags:")
+		printFlags(w, own)
+	}
+	if len(network) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Network flags:")
+		printFlags(w, network)
+	}
+	if len(common) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Common flags (unset flags come from WIF_<FLAG> variables, then the profile):")
+		printFlags(w, common)
+	}
+
+	for _, note := range c.Notes {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, note)
+	}
+
+	if len(c.Examples) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Examples:")
+		for _, example := range c.Examples {
+			fmt.Fprintf(w, "  %s %s\n", prog, example)
+		}
+	}
+}
+
+// PrintFlags writes every flag of fs in the format of PrintHelp.
+func PrintFlags(w io.Writer, fs *flag.FlagSet) {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	printFlags(w, flags)
+}
+
+// printFlags writes flags as aligned "--name <type>  usage (default)"
+// lines.
+func printFlags(w io.Writer, flags []*flag.Flag) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, f := range flags {
+		typeName, usage := flag.UnquoteUsage(f)
+		name := "--" + f.Name
+		if typeName != "" {
+			name += " <" + typeName + ">"
+		}
+		if showDefault(f) {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", name, usage)
+	}
+	tw.Flush()
+}
+
+func showDefault(f *flag.Flag) bool {
+	switch f.DefValue {
+	case "", "0", "0s", "false", "[]", "map[]":
+		return false
+	}
+	return true
+}
+
+// Fail reports a usage error: the message, then the command's help. It
+// exits with status 1.
+func Fail(fs *flag.FlagSet, message string) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n\n", message)
+	fs.Usage()
+	os.Exit(1)
+}
+
+// Main runs a standalone binary. Binaries with several commands, such as
+// manage-topic, pick one by the action given as the first argument.
+func Main(commands ...*Command) {
+	if len(commands) == 1 {
+		c := commands[0]
+		c.Run("./bin/"+c.Binary, os.Args[1:])
+		return
+	}
+
+	if len(os.Args) > 1 {
+		for _, c := range commands {
+			if strings.HasSuffix(c.Binary, " "+os.Args[1]) {
+				c.Run("./bin/"+c.Binary, os.Args[2:])
+				return
+			}
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "Error: Missing or unknown action")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Usage:")
+	for _, c := range commands {
+		for _, synopsis := range c.Synopsis {
+			fmt.Fprintf(os.Stderr, "  ./bin/%s %s\n", c.Binary, synopsis)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run an action with --help for its flags.")
+	os.Exit(1)
+}
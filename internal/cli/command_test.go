@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProfiles = `default-profile: dev
+profiles:
+  dev:
+    pool-id: dev-pool
+    audience: gcp-workload-identity
+    subject: alice
+    ack-deadline: 5m
+    print: json
+    create-jwt.audience: https://iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/dev-pool/providers/p
+    create-jwt.subject: ci
+    manage-subscription.ack-deadline: 30s
+`
+
+func TestApplyDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testProfiles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		binary string
+		flags  []string
+		args   []string
+		env    map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "shared and scoped keys",
+			binary: "create-jwt",
+			flags:  []string{"pool-id", "audience", "subject"},
+			want: map[string]string{
+				"pool-id":  "dev-pool",
+				"audience": "https://iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/dev-pool/providers/p",
+				"subject":  "ci",
+			},
+		},
+		{
+			name:   "another command's keys don't leak",
+			binary: "sign-jwt",
+			flags:  []string{"pool-id", "audience", "subject"},
+			want:   map[string]string{"pool-id": "dev-pool", "audience": "", "subject": ""},
+		},
+		{
+			name:   "scoped by the binary, not the action",
+			binary: "manage-subscription create",
+			flags:  []string{"ack-deadline"},
+			want:   map[string]string{"ack-deadline": "30s"},
+		},
+		{
+			name:   "unscoped per-command key",
+			binary: "pull-messages",
+			flags:  []string{"ack-deadline"},
+			want:   map[string]string{"ack-deadline": ""},
+		},
+		{
+			name:   "unscoped print",
+			binary: "list-topics",
+			flags:  []string{"print"},
+			want:   map[string]string{"print": ""},
+		},
+		{
+			name:   "flag over profile",
+			binary: "create-jwt",
+			flags:  []string{"subject"},
+			args:   []string{"--subject", "bob"},
+			want:   map[string]string{"subject": "bob"},
+		},
+		{
+			name:   "environment over profile",
+			binary: "create-jwt",
+			flags:  []string{"pool-id"},
+			env:    map[string]string{"WIF_POOL_ID": "env-pool"},
+			want:   map[string]string{"pool-id": "env-pool"},
+		},
+		{
+			name:   "no WIF_ variable for per-command flags",
+			binary: "sign-jwt",
+			flags:  []string{"audience"},
+			env:    map[string]string{"WIF_AUDIENCE": "gcp-workload-identity"},
+			want:   map[string]string{"audience": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			fs := flag.NewFlagSet(tt.binary, flag.ContinueOnError)
+			for _, name := range tt.flags {
+				fs.String(name, "", "")
+			}
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &Command{Binary: tt.binary}
+			if err := c.applyDefaults(fs, path, ""); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("--%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDefaultsInvalidScopedValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("profiles:\n  dev:\n    pull-messages.ack-deadline: soon\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("pull-messages", flag.ContinueOnError)
+	fs.Duration("ack-deadline", 0, "")
+	c := &Command{Binary: "pull-messages"}
+	err := c.applyDefaults(fs, path, "dev")
+	if err == nil || !strings.Contains(err.Error(), "invalid pull-messages.ack-deadline in profile") {
+		t.Errorf("applyDefaults() error = %v, want one naming pull-messages.ack-deadline", err)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantArgs []string
+		wantFlag string
+	}{
+		{[]string{"--profile", "prod", "https://example.com"}, []string{"https://example.com"}, "prod"},
+		{[]string{"https://example.com", "--profile", "prod"}, []string{"https://example.com"}, "prod"},
+		{[]string{"a", "--profile", "prod", "b"}, []string{"a", "b"}, "prod"},
+		{[]string{"a", "--", "--profile"}, []string{"a", "--profile"}, ""},
+		{[]string{"a", "--", "b", "--profile", "prod"}, []string{"a", "b", "--profile", "prod"}, ""},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("call", flag.ContinueOnError)
+		profile := fs.String("profile", "", "")
+		fs.Parse(tt.args)
+		parseInterspersed(fs)
+		if strings.Join(fs.Args(), " ") != strings.Join(tt.wantArgs, " ") || *profile != tt.wantFlag {
+			t.Errorf("%q: args %q, --profile %q; want %q, %q", tt.args, fs.Args(), *profile, tt.wantArgs, tt.wantFlag)
+		}
+	}
+}
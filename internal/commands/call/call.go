@@ -0,0 +1,283 @@
+// Package call implements "wif call" (call).
+package call
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"wif-poc/internal/apierror"
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+)
+
+// Command sends a request to any Google API with the federated identity.
+var Command = &cli.Command{
+	Name:    "call",
+	Binary:  "call",
+	Summary: "Call any Google API with the federated identity, like curl",
+	Synopsis: []string{
+		"<URL> --token-input <PATH> [options]",
+		"<PATH> --service <SERVICE> --token-input <PATH> [options]",
+		"<URL> --subject-token <PATH> --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> [--service-account <SA_EMAIL>] [options]",
+	},
+	Notes: []string{
+		"Credentials come from --token-input, or from exchanging --subject-token in-process\n" +
+			"(workload pools). Flags may come before or after the URL.",
+	},
+	Examples: []string{
+		"/v1/projects/my-project/topics --service pubsub --token-input gcp_access_token.txt --query pageSize=5",
+		"https://storage.googleapis.com/storage/v1/b --query project=my-project --token-input gcp_access_token.txt --body-only | jq -r '.items[].name'",
+		"/v1/projects/my-project/topics/wif-test:publish --service pubsub --token-input gcp_access_token.txt --data '{\"messages\":[{\"data\":\"aGVsbG8=\"}]}'",
+	},
+	Env:          map[string]string{"quota-project": EnvQuotaProject},
+	Interspersed: true,
+	Setup:        setup,
+}
+
+// EnvQuotaProject sets the default --quota-project, as in gcloud and the
+// client libraries.
+const EnvQuotaProject = "GOOGLE_CLOUD_QUOTA_PROJECT"
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+func setup(fs *flag.FlagSet) func() {
+	method := fs.String("method", "", "HTTP method (default GET, or POST with --data)")
+	service := fs.String("service", "", "API a path argument is relative to, e.g. pubsub -> https://pubsub.googleapis.com")
+	query := url.Values{}
+	fs.Func("query", "Query parameter as key=value, repeatable", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("%q must be in key=value form", v)
+		}
+		query.Add(key, value)
+		return nil
+	})
+	data := fs.String("data", "", "JSON request body, @FILE to read it from a file or @- from stdin")
+	var headers cli.Headers
+	fs.Var(&headers, "header", "Extra request header as \"Name: value\", repeatable")
+	quotaProject := fs.String("quota-project", os.Getenv(EnvQuotaProject), "Project billed for the request, sent as x-goog-user-project (env "+EnvQuotaProject+")")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file from exchange-token, - for stdin")
+	var exchange liveExchange
+	fs.StringVar(&exchange.SubjectTokenPath, "subject-token", "", "External JWT to exchange in-process instead of --token-input, - for stdin")
+	fs.StringVar(&exchange.ProjectNumber, "project-number", "", "GCP project number of the pool (with --subject-token)")
+	fs.StringVar(&exchange.PoolID, "pool-id", "", "Workload Identity Pool ID (with --subject-token)")
+	fs.StringVar(&exchange.ProviderID, "provider-id", "", "Identity Provider ID (with --subject-token)")
+	fs.StringVar(&exchange.ServiceAccount, "service-account", "", "Service account to impersonate (with --subject-token; the federated token is used when empty)")
+	include := fs.Bool("include", false, "Show all response headers, not only the relevant ones")
+	bodyOnly := fs.Bool("body-only", false, "Print only the response body, for piping into jq")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		target := fs.Arg(0)
+		liveExchangeReady := exchange.SubjectTokenPath != "" && exchange.ProjectNumber != "" && exchange.PoolID != "" && exchange.ProviderID != ""
+		if target == "" || fs.NArg() > 1 || (*tokenPath == "") == !liveExchangeReady {
+			cli.Fail(fs, "Missing URL or required parameters")
+		}
+
+		if *bodyOnly {
+			cli.Log = io.Discard
+		}
+
+		rawURL, err := resolveURL(target, *service)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(query) > 0 {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid URL: %v\n", err)
+				os.Exit(1)
+			}
+			q := u.Query()
+			for key, values := range query {
+				q[key] = append(q[key], values...)
+			}
+			u.RawQuery = q.Encode()
+			rawURL = u.String()
+		}
+
+		body, err := readBody(*data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *method == "" {
+			*method = "GET"
+			if body != nil {
+				*method = "POST"
+			}
+		}
+		*method = strings.ToUpper(*method)
+
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with the response.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+		ctx := context.Background()
+
+		var accessToken string
+		if *tokenPath != "" {
+			accessToken, err = cli.ReadAccessToken(*tokenPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+				fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+				os.Exit(1)
+			}
+		} else {
+			accessToken, err = exchange.token(ctx, cli.Log)
+			if err != nil {
+				cli.PrintError(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		header := http.Header{}
+		header.Set("Authorization", "Bearer "+accessToken)
+		if body != nil {
+			header.Set("Content-Type", "application/json")
+		}
+		if *quotaProject != "" {
+			header.Set("x-goog-user-project", *quotaProject)
+		}
+		for _, h := range headers {
+			name, value, _ := strings.Cut(h, ":")
+			header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+
+		fmt.Fprintln(cli.Log, "=== Calling Google API ===")
+		fmt.Fprintln(cli.Log, "Using the access token to call the API with the federated identity")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Request:")
+		fmt.Fprintf(cli.Log, "  %s %s\n", *method, rawURL)
+		for _, name := range sortedKeys(header) {
+			value := header.Get(name)
+			if name == "Authorization" {
+				value = "Bearer " + redact(accessToken)
+			}
+			fmt.Fprintf(cli.Log, "  %s: %s\n", name, value)
+		}
+		if body != nil {
+			fmt.Fprintf(cli.Log, "  Body: %d bytes\n", len(body))
+		}
+		fmt.Fprintln(cli.Log)
+
+		resp, err := httpClient.Do(ctx, *method, rawURL, header, body)
+		if err != nil {
+			cli.PrintError(os.Stderr, fmt.Errorf("request failed: %w", err))
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log, "Response:")
+		fmt.Fprintf(cli.Log, "  Status: %d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+		for _, name := range sortedKeys(resp.Header) {
+			if *include || relevantHeader(name) {
+				fmt.Fprintf(cli.Log, "  %s: %s\n", name, strings.Join(resp.Header.Values(name), ", "))
+			}
+		}
+		fmt.Fprintln(cli.Log)
+
+		if len(resp.Body) > 0 {
+			var pretty bytes.Buffer
+			if json.Indent(&pretty, resp.Body, "", "  ") == nil {
+				fmt.Println(pretty.String())
+			} else {
+				os.Stdout.Write(resp.Body)
+				if !bytes.HasSuffix(resp.Body, []byte("\n")) {
+					fmt.Println()
+				}
+			}
+		}
+
+		if resp.StatusCode >= 400 {
+			api := *service
+			if u, err := url.Parse(rawURL); api == "" && err == nil {
+				api = u.Host
+			}
+			fmt.Fprintln(os.Stderr)
+			cli.PrintError(os.Stderr, apierror.Parse(api, resp.StatusCode, resp.Body))
+			os.Exit(1)
+		}
+	}
+}
+
+// resolveURL accepts a full URL, or a path relative to the service's
+// endpoint (which honors --endpoint-base and --universe-domain).
+func resolveURL(target, service string) (string, error) {
+	switch {
+	case strings.HasPrefix(target, "https://"), strings.HasPrefix(target, "http://"):
+		return target, nil
+	case strings.HasPrefix(target, "/"):
+		if service == "" {
+			return "", fmt.Errorf("a path needs --service, e.g. --service pubsub %s", target)
+		}
+		return netConfig.ServiceURL(service) + target, nil
+	}
+	return "", fmt.Errorf("%q is neither a URL nor a path starting with /", target)
+}
+
+// readBody returns the --data value, reading it from a file for @FILE and
+// from stdin for @-. The body must be JSON.
+func readBody(data string) ([]byte, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	body := []byte(data)
+	if path, ok := strings.CutPrefix(data, "@"); ok {
+		var err error
+		if body, err = cli.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read --data: %w", err)
+		}
+	}
+
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("--data is not valid JSON")
+	}
+	return body, nil
+}
+
+// relevantHeader reports whether a response header helps explain the
+// result: the content type, caching and redirect headers, retry hints,
+// authentication challenges and Google's own diagnostics.
+func relevantHeader(name string) bool {
+	switch name {
+	case "Content-Type", "Etag", "Location", "Retry-After", "Www-Authenticate":
+		return true
+	}
+	return strings.HasPrefix(name, "X-Goog-")
+}
+
+func sortedKeys(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redact keeps only the start of a token, enough to tell tokens apart.
+func redact(token string) string {
+	if len(token) <= 12 {
+		return "..."
+	}
+	return token[:12] + "..."
+}
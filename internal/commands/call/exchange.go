@@ -0,0 +1,65 @@
+package call
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/iamcredentials"
+	"wif-poc/internal/sts"
+)
+
+// liveExchange describes an exchange run in-process instead of reading a
+// token file written by exchange-token.
+type liveExchange struct {
+	SubjectTokenPath string // external JWT
+	ProjectNumber    string
+	PoolID           string
+	ProviderID       string
+	ServiceAccount   string // the federated token is used directly when empty
+}
+
+// token exchanges the JWT for a federated token and, with a service
+// account, for that account's access token.
+func (e *liveExchange) token(ctx context.Context, log io.Writer) (string, error) {
+	data, err := cli.ReadFile(e.SubjectTokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read subject token: %w", err)
+	}
+
+	stsClient := &sts.Client{HTTP: httpClient, BaseURL: netConfig.ServiceURL("sts")}
+	fmt.Fprintln(log, "Exchanging the subject token for a federated token...")
+	fmt.Fprintf(log, "  Endpoint: %s\n", stsClient.TokenURL())
+	federated, err := stsClient.Exchange(ctx, map[string]string{
+		"audience":           sts.WorkloadAudience(e.ProjectNumber, e.PoolID, e.ProviderID),
+		"subject_token_type": sts.TokenTypeJWT,
+		"subject_token":      strings.TrimSpace(string(data)),
+		"scope":              sts.CloudPlatformScope,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange for federated token: %w", err)
+	}
+	fmt.Fprintln(log, "  ✓ Received federated token")
+
+	if e.ServiceAccount == "" {
+		fmt.Fprintln(log)
+		return federated.AccessToken, nil
+	}
+
+	iamClient := &iamcredentials.Client{
+		HTTP:        httpClient,
+		BaseURL:     netConfig.ServiceURL("iamcredentials"),
+		AccessToken: federated.AccessToken,
+	}
+	fmt.Fprintf(log, "Impersonating %s...\n", e.ServiceAccount)
+	fmt.Fprintf(log, "  Endpoint: %s\n", iamClient.MethodURL(e.ServiceAccount, "generateAccessToken"))
+	accessToken, err := iamClient.GenerateAccessToken(ctx, e.ServiceAccount, []string{sts.CloudPlatformScope})
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange for access token: %w", err)
+	}
+	fmt.Fprintln(log, "  ✓ Received access token")
+	fmt.Fprintln(log)
+	return accessToken.AccessToken, nil
+}
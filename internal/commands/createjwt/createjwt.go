@@ -0,0 +1,179 @@
+// Package createjwt implements "wif jwt create" (create-jwt).
+package createjwt
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/keys"
+	"wif-poc/internal/output"
+)
+
+// Command mints a JWT signed with the simulated identity provider's key.
+var Command = &cli.Command{
+	Name:    "jwt create",
+	Binary:  "create-jwt",
+	Summary: "Create a JWT signed with the external identity provider's private key",
+	Synopsis: []string{
+		"--key-id <KEY_ID> --issuer <ISSUER_URL> --audience <AUDIENCE> --subject <SUBJECT> --private-key <PATH> --output <PATH> [--email <EMAIL>] [--environment <ENV>]",
+	},
+	Notes: []string{
+		"When GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE is set, create-jwt acts as an executable\n" +
+			"credential source and prints the pluggable auth JSON response instead.",
+	},
+	Examples: []string{
+		"--key-id key-1 --issuer https://my-external-idp.example.com --audience gcp-workload-identity --subject external-user-123 --private-key private_key.pem --output external_token.jwt --email user@example.com --environment production",
+	},
+	Setup: setup,
+}
+
+// result is the --print document.
+type result struct {
+	Path      string            `json:"path"`
+	Header    map[string]string `json:"header"`
+	Claims    jwt.MapClaims     `json:"claims"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	keyID := fs.String("key-id", "", "Key ID matching the JWK (required)")
+	issuer := fs.String("issuer", "", "Issuer URL for the JWT, e.g. https://my-external-idp.example.com (required)")
+	audience := fs.String("audience", "", "Audience for the JWT, matching the WIF provider's configuration (required)")
+	subject := fs.String("subject", "", "Subject (user identifier) for the JWT (required)")
+	email := fs.String("email", "", "User email address (optional)")
+	environment := fs.String("environment", "", "Environment name, e.g. production or staging (optional)")
+	privateKeyPath := fs.String("private-key", "", "Path to the private key PEM file (required)")
+	outputPath := fs.String("output", "", "Path to save the JWT token, - for stdout (required)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+
+	return func() {
+		// Google client libraries run us as an executable credential source and
+		// pass the request through GOOGLE_EXTERNAL_ACCOUNT_* variables.
+		if os.Getenv(envAudience) != "" {
+			runExecutableSource(executableParams{
+				KeyID:          *keyID,
+				Issuer:         *issuer,
+				Audience:       *audience,
+				Subject:        *subject,
+				Email:          *email,
+				Environment:    *environment,
+				PrivateKeyPath: *privateKeyPath,
+			})
+			return
+		}
+
+		if *keyID == "" || *issuer == "" || *audience == "" || *subject == "" || *privateKeyPath == "" || *outputPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+		if *printFormat != "" && *outputPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --print and --output - both write to stdout; save the token to a file to use --print")
+			os.Exit(1)
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		fmt.Fprintln(cli.Log, "=== Step 2: Creating and Signing JWT Token ===")
+		fmt.Fprintln(cli.Log, "This token represents an identity from the external provider")
+		fmt.Fprintln(cli.Log)
+
+		// Load the private key
+		privateKey, err := keys.LoadPrivateKey(*privateKeyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading private key: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run generate-keys first!")
+			os.Exit(1)
+		}
+
+		// Create JWT claims
+		now := time.Now()
+		expiresAt := now.Add(1 * time.Hour)
+		claims := newClaims(*issuer, *subject, *audience, *email, *environment, now, expiresAt)
+
+		// Sign the token with the private key
+		tokenString, err := signToken(privateKey, *keyID, claims)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing token: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Save the token, readable by the owner only since it's a credential
+		if err := cli.WriteFile(*outputPath, []byte(tokenString)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing token file: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log, "✓ Created and signed JWT token")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Token claims:")
+		claimsJSON, _ := json.MarshalIndent(claims, "  ", "  ")
+		fmt.Fprintf(cli.Log, "  %s\n", claimsJSON)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintf(cli.Log, "Token saved to: %s\n", cli.OutputName(*outputPath))
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Token preview (first 100 chars):")
+		if len(tokenString) > 100 {
+			fmt.Fprintf(cli.Log, "  %s...\n", tokenString[:100])
+		} else {
+			fmt.Fprintf(cli.Log, "  %s\n", tokenString)
+		}
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Configure GCP Workload Identity Pool, then run:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/exchange-token --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL>")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Example:")
+		fmt.Fprintln(cli.Log, "  ./bin/exchange-token --project-number 123456789 --pool-id my-pool --provider-id my-provider --service-account my-sa@my-project.iam.gserviceaccount.com")
+
+		if *printFormat != "" {
+			r := result{
+				Path:      *outputPath,
+				Header:    map[string]string{"alg": "RS256", "typ": "JWT", "kid": *keyID},
+				Claims:    claims,
+				ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+			}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+func newClaims(issuer, subject, audience, email, environment string, issuedAt, expiresAt time.Time) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"sub": subject,
+		"aud": audience,
+		"iat": issuedAt.Unix(),
+		"exp": expiresAt.Unix(),
+	}
+
+	// Add optional claims if provided
+	if email != "" {
+		claims["email"] = email
+	}
+	if environment != "" {
+		claims["environment"] = environment
+	}
+	return claims
+}
+
+func signToken(privateKey *rsa.PrivateKey, keyID string, claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(privateKey)
+}
@@ -0,0 +1,143 @@
+package createjwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"wif-poc/internal/keys"
+)
+
+// Environment variables set by Google client libraries when they run an
+// executable-sourced credential (pluggable auth).
+const (
+	envAudience   = "GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE"
+	envTokenType  = "GOOGLE_EXTERNAL_ACCOUNT_TOKEN_TYPE"
+	envOutputFile = "GOOGLE_EXTERNAL_ACCOUNT_OUTPUT_FILE"
+
+	tokenTypeJWT     = "urn:ietf:params:oauth:token-type:jwt"
+	tokenTypeIDToken = "urn:ietf:params:oauth:token-type:id_token"
+
+	executableResponseVersion = 1
+)
+
+type executableParams struct {
+	KeyID          string
+	Issuer         string
+	Audience       string
+	Subject        string
+	Email          string
+	Environment    string
+	PrivateKeyPath string
+}
+
+// executableResponse is the versioned JSON document pluggable auth expects
+// on stdout and in the optional output file.
+type executableResponse struct {
+	Version        int    `json:"version"`
+	Success        bool   `json:"success"`
+	TokenType      string `json:"token_type,omitempty"`
+	IDToken        string `json:"id_token,omitempty"`
+	ExpirationTime int64  `json:"expiration_time,omitempty"`
+	Code           string `json:"code,omitempty"`
+	Message        string `json:"message,omitempty"`
+}
+
+// runExecutableSource prints a signed JWT as a pluggable auth response. A
+// still-valid response in GOOGLE_EXTERNAL_ACCOUNT_OUTPUT_FILE is reused
+// instead of minting a new token.
+func runExecutableSource(p executableParams) {
+	tokenType := os.Getenv(envTokenType)
+	if tokenType == "" {
+		tokenType = tokenTypeJWT
+	}
+	if tokenType != tokenTypeJWT && tokenType != tokenTypeIDToken {
+		writeExecutableError("UNSUPPORTED_TOKEN_TYPE", fmt.Sprintf("create-jwt cannot produce %s tokens", tokenType))
+	}
+
+	if p.KeyID == "" || p.Issuer == "" || p.Subject == "" || p.PrivateKeyPath == "" {
+		writeExecutableError("INVALID_ARGUMENT", "--key-id, --issuer, --subject and --private-key are required in the credential config command")
+	}
+
+	outputFile := os.Getenv(envOutputFile)
+	if outputFile != "" {
+		if cached, ok := cachedExecutableResponse(outputFile, tokenType); ok {
+			os.Stdout.Write(cached)
+			return
+		}
+	}
+
+	// Without an explicit --audience, use the provider's default allowed
+	// audience: the provider resource name prefixed with "https:".
+	audience := p.Audience
+	if audience == "" {
+		audience = "https:" + os.Getenv(envAudience)
+	}
+
+	privateKey, err := keys.LoadPrivateKey(p.PrivateKeyPath)
+	if err != nil {
+		writeExecutableError("PRIVATE_KEY_ERROR", err.Error())
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(1 * time.Hour)
+	claims := newClaims(p.Issuer, p.Subject, audience, p.Email, p.Environment, now, expiresAt)
+
+	tokenString, err := signToken(privateKey, p.KeyID, claims)
+	if err != nil {
+		writeExecutableError("SIGNING_ERROR", err.Error())
+	}
+
+	response, err := json.Marshal(executableResponse{
+		Version:        executableResponseVersion,
+		Success:        true,
+		TokenType:      tokenType,
+		IDToken:        tokenString,
+		ExpirationTime: expiresAt.Unix(),
+	})
+	if err != nil {
+		writeExecutableError("INTERNAL", err.Error())
+	}
+
+	if outputFile != "" {
+		if err := os.WriteFile(outputFile, response, 0600); err != nil {
+			writeExecutableError("OUTPUT_FILE_ERROR", err.Error())
+		}
+	}
+
+	os.Stdout.Write(response)
+}
+
+// cachedExecutableResponse returns the output file contents when they hold a
+// successful, unexpired response of the requested token type.
+func cachedExecutableResponse(path, tokenType string) ([]byte, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cached executableResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, false
+	}
+
+	if cached.Version != executableResponseVersion || !cached.Success || cached.TokenType != tokenType || cached.IDToken == "" {
+		return nil, false
+	}
+	if cached.ExpirationTime <= time.Now().Unix() {
+		return nil, false
+	}
+	return data, true
+}
+
+func writeExecutableError(code, message string) {
+	response, _ := json.Marshal(executableResponse{
+		Version: executableResponseVersion,
+		Success: false,
+		Code:    code,
+		Message: message,
+	})
+	os.Stdout.Write(response)
+	os.Exit(1)
+}
@@ -0,0 +1,331 @@
+// Package createsaml implements "wif saml create" (create-saml).
+package createsaml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/keys"
+	"wif-poc/internal/output"
+)
+
+const (
+	samlAssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlMetadataNS  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	xmlDSigNS       = "http://www.w3.org/2000/09/xmldsig#"
+	excC14NAlg      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedAlg    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	rsaSHA256Alg    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	sha256Alg       = "http://www.w3.org/2001/04/xmlenc#sha256"
+	samlTimeFormat  = "2006-01-02T15:04:05Z"
+)
+
+// Command mints a signed SAML 2.0 assertion for SAML providers.
+var Command = &cli.Command{
+	Name:    "saml create",
+	Binary:  "create-saml",
+	Summary: "Create a signed SAML 2.0 assertion and the IdP metadata for a SAML provider",
+	Synopsis: []string{
+		"--issuer <ENTITY_ID> --audience <AUDIENCE> --subject <SUBJECT> --private-key <PATH> --output <PATH> [--email <EMAIL>] [--environment <ENV>] [--certificate-output <PATH>] [--metadata-output <PATH>]",
+	},
+	Examples: []string{
+		"--issuer https://my-external-idp.example.com --audience https://iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/my-pool/providers/my-saml-provider --subject external-user-123 --private-key private_key.pem --output external_assertion.saml --metadata-output idp_metadata.xml",
+	},
+	Setup: setup,
+}
+
+// result is the --print document. Optional paths are empty when not
+// written.
+type result struct {
+	Path            string    `json:"path"`
+	CertificatePath string    `json:"certificatePath,omitempty"`
+	MetadataPath    string    `json:"metadataPath,omitempty"`
+	Issuer          string    `json:"issuer"`
+	Audience        string    `json:"audience"`
+	Subject         string    `json:"subject"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	issuer := fs.String("issuer", "", "IdP entity ID placed in the assertion's Issuer, matching the provider's IdP metadata (required)")
+	audience := fs.String("audience", "", "SP entity ID, e.g. https://iam.googleapis.com/projects/<NUM>/locations/global/workloadIdentityPools/<POOL>/providers/<PROVIDER> (required)")
+	subject := fs.String("subject", "", "Subject NameID for the assertion (required)")
+	email := fs.String("email", "", "User email address attribute (optional)")
+	environment := fs.String("environment", "", "Environment name attribute (optional)")
+	recipient := fs.String("recipient", "https://sts.googleapis.com/v1/token", "Recipient in the bearer subject confirmation")
+	privateKeyPath := fs.String("private-key", "", "Path to the private key PEM file from generate-keys (required)")
+	outputPath := fs.String("output", "", "Path to save the base64-encoded SAML assertion, - for stdout (required)")
+	certificatePath := fs.String("certificate-output", "", "Path to save the self-signed signing certificate (optional)")
+	metadataPath := fs.String("metadata-output", "", "Path to save IdP metadata XML for the GCP SAML provider, used with --idp-metadata-path (optional)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+
+	return func() {
+		if *issuer == "" || *audience == "" || *subject == "" || *privateKeyPath == "" || *outputPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+		if *printFormat != "" && *outputPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --print and --output - both write to stdout; save the assertion to a file to use --print")
+			os.Exit(1)
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		fmt.Fprintln(cli.Log, "=== Step 2 (SAML): Creating and Signing SAML Assertion ===")
+		fmt.Fprintln(cli.Log, "This assertion represents an identity from the external SAML provider")
+		fmt.Fprintln(cli.Log)
+
+		// Load the private key
+		privateKey, err := keys.LoadPrivateKey(*privateKeyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading private key: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run generate-keys first!")
+			os.Exit(1)
+		}
+
+		// The SAML provider trusts a certificate, not a bare public key, so wrap
+		// the key pair in a self-signed certificate.
+		certDER, err := selfSignedCertificate(privateKey, *issuer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating signing certificate: %v\n", err)
+			os.Exit(1)
+		}
+
+		now := time.Now().UTC()
+		expiresAt := now.Add(1 * time.Hour)
+		attributes := map[string]string{}
+		if *email != "" {
+			attributes["email"] = *email
+		}
+		if *environment != "" {
+			attributes["environment"] = *environment
+		}
+
+		assertionXML, err := signedAssertion(assertionParams{
+			ID:         newSAMLID(),
+			Issuer:     *issuer,
+			Audience:   *audience,
+			Subject:    *subject,
+			Recipient:  *recipient,
+			Attributes: attributes,
+			IssuedAt:   now,
+			ExpiresAt:  expiresAt,
+		}, privateKey, certDER)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing assertion: %v\n", err)
+			os.Exit(1)
+		}
+
+		encoded := base64.StdEncoding.EncodeToString([]byte(assertionXML))
+		if err := cli.WriteFile(*outputPath, []byte(encoded)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing assertion file: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log, "✓ Created and signed SAML assertion")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Assertion XML:")
+		fmt.Fprintf(cli.Log, "  %s\n", assertionXML)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintf(cli.Log, "Base64-encoded assertion saved to: %s\n", cli.OutputName(*outputPath))
+
+		if *certificatePath != "" {
+			certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+			if err := os.WriteFile(*certificatePath, certPEM, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing certificate file: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(cli.Log, "Signing certificate saved to: %s\n", *certificatePath)
+		}
+
+		if *metadataPath != "" {
+			if err := os.WriteFile(*metadataPath, []byte(idpMetadata(*issuer, certDER)), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing metadata file: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(cli.Log, "IdP metadata saved to: %s\n", *metadataPath)
+		}
+
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Create a SAML provider from the IdP metadata, then run:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/exchange-token --subject-token-type saml2 --token-input <PATH> --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --output <PATH>")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Example:")
+		fmt.Fprintln(cli.Log, "  gcloud iam workload-identity-pools providers create-saml my-saml-provider --location=global --workload-identity-pool=my-pool --idp-metadata-path=idp_metadata.xml --attribute-mapping=\"google.subject=assertion.subject\"")
+		fmt.Fprintf(cli.Log, "  ./bin/exchange-token --subject-token-type saml2 --token-input %s --project-number 123456789 --pool-id my-pool --provider-id my-saml-provider --service-account my-sa@my-project.iam.gserviceaccount.com --output gcp_access_token.txt\n", *outputPath)
+
+		if *printFormat != "" {
+			r := result{
+				Path:            *outputPath,
+				CertificatePath: *certificatePath,
+				MetadataPath:    *metadataPath,
+				Issuer:          *issuer,
+				Audience:        *audience,
+				Subject:         *subject,
+				ExpiresAt:       expiresAt.Truncate(time.Second),
+			}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+type assertionParams struct {
+	ID         string
+	Issuer     string
+	Audience   string
+	Subject    string
+	Recipient  string
+	Attributes map[string]string
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+}
+
+// signedAssertion renders a SAML 2.0 assertion with an enveloped XML
+// signature. The XML is emitted directly in exclusive canonical form (no
+// insignificant whitespace, sorted attributes, explicit end tags), so the
+// digest and signature can be computed over the literal bytes without an
+// XML canonicalization library.
+func signedAssertion(p assertionParams, key *rsa.PrivateKey, certDER []byte) (string, error) {
+	issueInstant := p.IssuedAt.Format(samlTimeFormat)
+	notOnOrAfter := p.ExpiresAt.Format(samlTimeFormat)
+
+	issuer := "<saml:Issuer>" + xmlText(p.Issuer) + "</saml:Issuer>"
+
+	var body strings.Builder
+	body.WriteString("<saml:Subject>")
+	body.WriteString(`<saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">` + xmlText(p.Subject) + "</saml:NameID>")
+	body.WriteString(`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">`)
+	body.WriteString(`<saml:SubjectConfirmationData NotOnOrAfter="` + notOnOrAfter + `" Recipient="` + xmlAttr(p.Recipient) + `"></saml:SubjectConfirmationData>`)
+	body.WriteString("</saml:SubjectConfirmation>")
+	body.WriteString("</saml:Subject>")
+	body.WriteString(`<saml:Conditions NotBefore="` + issueInstant + `" NotOnOrAfter="` + notOnOrAfter + `">`)
+	body.WriteString("<saml:AudienceRestriction><saml:Audience>" + xmlText(p.Audience) + "</saml:Audience></saml:AudienceRestriction>")
+	body.WriteString("</saml:Conditions>")
+	body.WriteString(`<saml:AuthnStatement AuthnInstant="` + issueInstant + `" SessionIndex="` + p.ID + `">`)
+	body.WriteString("<saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified</saml:AuthnContextClassRef></saml:AuthnContext>")
+	body.WriteString("</saml:AuthnStatement>")
+	if len(p.Attributes) > 0 {
+		body.WriteString("<saml:AttributeStatement>")
+		for _, name := range []string{"email", "environment"} {
+			value, ok := p.Attributes[name]
+			if !ok {
+				continue
+			}
+			body.WriteString(`<saml:Attribute Name="` + xmlAttr(name) + `">`)
+			body.WriteString("<saml:AttributeValue>" + xmlText(value) + "</saml:AttributeValue>")
+			body.WriteString("</saml:Attribute>")
+		}
+		body.WriteString("</saml:AttributeStatement>")
+	}
+
+	open := `<saml:Assertion xmlns:saml="` + samlAssertionNS + `" ID="` + p.ID + `" IssueInstant="` + issueInstant + `" Version="2.0">`
+	closing := "</saml:Assertion>"
+
+	// The enveloped-signature transform removes the Signature element, so
+	// the digest covers the assertion exactly as it looks without it.
+	digest := sha256.Sum256([]byte(open + issuer + body.String() + closing))
+
+	signedInfoBody := `<ds:CanonicalizationMethod Algorithm="` + excC14NAlg + `"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="` + rsaSHA256Alg + `"></ds:SignatureMethod>` +
+		`<ds:Reference URI="#` + p.ID + `">` +
+		`<ds:Transforms>` +
+		`<ds:Transform Algorithm="` + envelopedAlg + `"></ds:Transform>` +
+		`<ds:Transform Algorithm="` + excC14NAlg + `"></ds:Transform>` +
+		`</ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="` + sha256Alg + `"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference>`
+
+	// Canonicalized on its own, SignedInfo carries the ds namespace
+	// declaration it inherits from Signature.
+	canonicalSignedInfo := `<ds:SignedInfo xmlns:ds="` + xmlDSigNS + `">` + signedInfoBody + `</ds:SignedInfo>`
+	signedInfoHash := sha256.Sum256([]byte(canonicalSignedInfo))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, signedInfoHash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign SignedInfo: %w", err)
+	}
+
+	signatureXML := `<ds:Signature xmlns:ds="` + xmlDSigNS + `">` +
+		`<ds:SignedInfo>` + signedInfoBody + `</ds:SignedInfo>` +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(signature) + `</ds:SignatureValue>` +
+		`<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(certDER) + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo>` +
+		`</ds:Signature>`
+
+	// Per the SAML schema the Signature element follows Issuer.
+	return open + issuer + signatureXML + body.String() + closing, nil
+}
+
+// idpMetadata renders a minimal IdP EntityDescriptor advertising the signing
+// certificate, suitable for --idp-metadata-path.
+func idpMetadata(entityID string, certDER []byte) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<md:EntityDescriptor xmlns:md="` + samlMetadataNS + `" entityID="` + xmlAttr(entityID) + `">` + "\n" +
+		`  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol" WantAuthnRequestsSigned="false">` + "\n" +
+		`    <md:KeyDescriptor use="signing">` + "\n" +
+		`      <ds:KeyInfo xmlns:ds="` + xmlDSigNS + `">` + "\n" +
+		`        <ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(certDER) + `</ds:X509Certificate></ds:X509Data>` + "\n" +
+		`      </ds:KeyInfo>` + "\n" +
+		`    </md:KeyDescriptor>` + "\n" +
+		`    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="` + xmlAttr(strings.TrimSuffix(entityID, "/")+"/sso") + `"/>` + "\n" +
+		`  </md:IDPSSODescriptor>` + "\n" +
+		`</md:EntityDescriptor>` + "\n"
+}
+
+func selfSignedCertificate(key *rsa.PrivateKey, issuer string) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: issuer},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	return x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+}
+
+// newSAMLID returns an xs:ID value; IDs must not start with a digit.
+func newSAMLID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return "_" + hex.EncodeToString(buf)
+}
+
+// xmlText escapes character data the way exclusive canonicalization does.
+func xmlText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(s)
+}
+
+// xmlAttr escapes attribute values the way exclusive canonicalization does.
+func xmlAttr(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;").Replace(s)
+}
@@ -0,0 +1,109 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const workloadIdentityUser = "roles/iam.workloadIdentityUser"
+
+// policy is the part of an IAM policy doctor checks.
+type policy struct {
+	Bindings []struct {
+		Role      string   `json:"role"`
+		Members   []string `json:"members"`
+		Condition *struct {
+			Expression string `json:"expression"`
+		} `json:"condition"`
+	} `json:"bindings"`
+}
+
+// checkBinding checks that the service account lets the token's federated
+// principal impersonate it.
+func (d *diagnosis) checkBinding(ctx context.Context) {
+	if d.ServiceAccount == "" {
+		d.add("binding", statusSkip, "no --service-account; the federated token is used directly", "")
+		return
+	}
+	if d.AdminToken == "" {
+		d.add("binding", statusSkip, "no --admin-token-input, so the service account's IAM policy can't be read",
+			"Pass a token that may read it, e.g.: gcloud auth print-access-token > admin_token.txt")
+		return
+	}
+
+	url := fmt.Sprintf("%s/v1/projects/-/serviceAccounts/%s:getIamPolicy", netConfig.ServiceURL("iam"), d.ServiceAccount)
+	var p policy
+	request := map[string]interface{}{"options": map[string]int{"requestedPolicyVersion": 3}}
+	if err := httpClient.CallJSON(ctx, "IAM", "POST", url, d.AdminToken, request, &p); err != nil {
+		fix := "Check that the admin token may read the service account's IAM policy (roles/iam.serviceAccountAdmin)"
+		if isNotFound(err) {
+			fix = "The service account doesn't exist. Check --service-account with: gcloud iam service-accounts list"
+		}
+		d.add("IAM policy", statusFail, fmt.Sprintf("failed to read the IAM policy: %v", err), fixFor(err, fix))
+		return
+	}
+
+	poolMember := "iam.googleapis.com/" + d.poolName()
+	accepted := map[string]string{"principalSet://" + poolMember + "/*": "every identity of the pool"}
+	if subject := d.attributes["google.subject"]; subject != "" {
+		accepted["principal://"+poolMember+"/subject/"+subject] = fmt.Sprintf("subject %q", subject)
+	} else if sub := d.claim("sub"); d.attributes == nil && sub != "" {
+		// The mapping wasn't read; assume the default google.subject=assertion.sub.
+		accepted["principal://"+poolMember+"/subject/"+sub] = fmt.Sprintf("subject %q", sub)
+	}
+	for name, value := range d.attributes {
+		if strings.HasPrefix(name, "attribute.") {
+			accepted["principalSet://"+poolMember+"/"+name+"/"+value] = fmt.Sprintf("%s %q", name, value)
+		}
+	}
+
+	var poolMembers []string
+	for _, b := range p.Bindings {
+		if b.Role != workloadIdentityUser {
+			continue
+		}
+		for _, member := range b.Members {
+			if what, ok := accepted[member]; ok {
+				detail := fmt.Sprintf("%s is granted to %s", workloadIdentityUser, what)
+				if b.Condition != nil {
+					d.add("binding", statusWarn, detail+fmt.Sprintf(" under the condition %q (not checked)", b.Condition.Expression), "")
+				} else {
+					d.add("binding", statusOK, detail, "")
+				}
+				return
+			}
+			if strings.Contains(member, "/workloadIdentityPools/") {
+				poolMembers = append(poolMembers, member)
+			}
+		}
+	}
+
+	fix := fmt.Sprintf("gcloud iam service-accounts add-iam-policy-binding %s --role=%s \\\n"+
+		"  --member=\"principalSet://%s/*\"\n"+
+		"New bindings can take several minutes to propagate.", d.ServiceAccount, workloadIdentityUser, poolMember)
+	for _, member := range poolMembers {
+		project := memberProject(member)
+		if strings.Contains(member, "/workloadIdentityPools/"+d.PoolID+"/") && project != d.ProjectNumber {
+			d.add("binding", statusFail, fmt.Sprintf("%s names project %q instead of the project number %s", member, project, d.ProjectNumber),
+				"Principals use the project number (gcloud projects describe PROJECT_ID --format='value(projectNumber)'):\n"+fix)
+			return
+		}
+	}
+	if len(poolMembers) > 0 {
+		d.add("binding", statusFail, fmt.Sprintf("%s is granted only to %s, not to this token's principal", workloadIdentityUser, strings.Join(poolMembers, ", ")), fix)
+		return
+	}
+	d.add("binding", statusFail, fmt.Sprintf("no principal of pool %s has %s on the service account", d.PoolID, workloadIdentityUser), fix)
+}
+
+// memberProject returns the projects/ segment of a principal or
+// principalSet member.
+func memberProject(member string) string {
+	_, rest, ok := strings.Cut(member, "/projects/")
+	if !ok {
+		return ""
+	}
+	project, _, _ := strings.Cut(rest, "/")
+	return project
+}
@@ -0,0 +1,147 @@
+package doctor
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckBinding(t *testing.T) {
+	const poolMember = "iam.googleapis.com/projects/" + testProjectNumber + "/locations/global/workloadIdentityPools/" + testPoolID
+	tests := []struct {
+		name       string
+		policy     map[string]interface{}
+		attributes map[string]string
+		want       status
+		detail     string
+	}{
+		{
+			name:   "whole pool",
+			policy: policyGranting("principalSet://" + poolMember + "/*"),
+			want:   statusOK,
+			detail: "every identity of the pool",
+		},
+		{
+			name:       "mapped subject",
+			policy:     policyGranting("principal://" + poolMember + "/subject/alice"),
+			attributes: map[string]string{"google.subject": "alice"},
+			want:       statusOK,
+			detail:     `subject "alice"`,
+		},
+		{
+			name:   "sub when the mapping wasn't read",
+			policy: policyGranting("principal://" + poolMember + "/subject/alice"),
+			want:   statusOK,
+			detail: `subject "alice"`,
+		},
+		{
+			name:       "attribute",
+			policy:     policyGranting("principalSet://" + poolMember + "/attribute.environment/prod"),
+			attributes: map[string]string{"google.subject": "alice", "attribute.environment": "prod"},
+			want:       statusOK,
+			detail:     `attribute.environment "prod"`,
+		},
+		{
+			name: "conditional binding",
+			policy: map[string]interface{}{"bindings": []interface{}{map[string]interface{}{
+				"role":      workloadIdentityUser,
+				"members":   []string{"principalSet://" + poolMember + "/*"},
+				"condition": map[string]string{"expression": "request.time < timestamp('2030-01-01T00:00:00Z')"},
+			}}},
+			want:   statusWarn,
+			detail: "not checked",
+		},
+		{
+			name:       "another subject",
+			policy:     policyGranting("principal://" + poolMember + "/subject/bob"),
+			attributes: map[string]string{"google.subject": "alice"},
+			want:       statusFail,
+			detail:     "not to this token's principal",
+		},
+		{
+			name:   "project ID instead of number",
+			policy: policyGranting("principalSet://iam.googleapis.com/projects/my-project/locations/global/workloadIdentityPools/" + testPoolID + "/*"),
+			want:   statusFail,
+			detail: `names project "my-project"`,
+		},
+		{
+			name: "other role",
+			policy: map[string]interface{}{"bindings": []interface{}{map[string]interface{}{
+				"role":    "roles/iam.serviceAccountTokenCreator",
+				"members": []string{"principalSet://" + poolMember + "/*"},
+			}}},
+			want:   statusFail,
+			detail: "no principal of pool",
+		},
+		{
+			name:   "empty policy",
+			policy: map[string]interface{}{},
+			want:   statusFail,
+			detail: "no principal of pool",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGCP()
+			f.policy = tt.policy
+			f.start(t)
+			d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+			d.attributes = tt.attributes
+
+			d.checkBinding(context.Background())
+			c := wantCheck(t, d, "binding")
+			if c.Status != tt.want || !strings.Contains(c.Detail, tt.detail) {
+				t.Errorf("binding = %s %q, want %s containing %q", c.Status, c.Detail, tt.want, tt.detail)
+			}
+			if c.Status == statusFail && !strings.Contains(c.Fix, "add-iam-policy-binding "+testServiceAccount) {
+				t.Errorf("fix %q should add the binding", c.Fix)
+			}
+		})
+	}
+}
+
+func TestCheckBindingErrors(t *testing.T) {
+	t.Run("service account not found", func(t *testing.T) {
+		newFakeGCP().start(t)
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.ServiceAccount = "missing@my-project.iam.gserviceaccount.com"
+		d.checkBinding(context.Background())
+
+		c := wantCheck(t, d, "IAM policy")
+		if c.Status != statusFail || !strings.Contains(c.Fix, "doesn't exist") {
+			t.Errorf("IAM policy = %s, fix %q; want a failure saying the service account doesn't exist", c.Status, c.Fix)
+		}
+	})
+	t.Run("bad admin token", func(t *testing.T) {
+		newFakeGCP().start(t)
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.AdminToken = "expired-token"
+		d.checkBinding(context.Background())
+		wantStatuses(t, d, map[string]status{"IAM policy": statusFail})
+	})
+	t.Run("no service account", func(t *testing.T) {
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.ServiceAccount = ""
+		d.checkBinding(context.Background())
+		wantStatuses(t, d, map[string]status{"binding": statusSkip})
+	})
+	t.Run("no admin token", func(t *testing.T) {
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.AdminToken = ""
+		d.checkBinding(context.Background())
+		wantStatuses(t, d, map[string]status{"binding": statusSkip})
+	})
+}
+
+func TestMemberProject(t *testing.T) {
+	tests := map[string]string{
+		"principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/*":              "123",
+		"principal://iam.googleapis.com/projects/my-project/locations/global/workloadIdentityPools/p/subject/alice": "my-project",
+		"user:admin@example.com": "",
+	}
+	for member, want := range tests {
+		if got := memberProject(member); got != want {
+			t.Errorf("memberProject(%q) = %q, want %q", member, got, want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package doctor implements "wif doctor" (doctor).
+package doctor
+
+import (
+	"context"
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+)
+
+// Command checks a federation setup step by step.
+var Command = &cli.Command{
+	Name:    "doctor",
+	Binary:  "doctor",
+	Summary: "Diagnose a federation setup end to end: keys, JWT, provider, service account binding and the exchange",
+	Synopsis: []string{
+		"--project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --token-input <PATH> [--private-key <PATH>] [--public-key <PATH>] [--jwks <PATH>] [--admin-token-input <PATH>]",
+	},
+	Notes: []string{
+		"The provider and the service account's IAM policy are read with --admin-token-input, a token of an\n" +
+			"administrator (e.g. from gcloud auth print-access-token); without it those checks are skipped.",
+		"Exits with status 2 when a check fails.",
+	},
+	Examples: []string{
+		"--project-number 123456789 --pool-id my-pool --provider-id my-provider --service-account my-sa@my-project.iam.gserviceaccount.com --token-input external_token.jwt --private-key private_key.pem --jwks public_key.jwks --admin-token-input admin_token.txt",
+	},
+	Setup: setup,
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+// clockSkew is how far iat and nbf may be in the future.
+const clockSkew = 5 * time.Minute
+
+// status is the outcome of a check.
+type status string
+
+const (
+	statusOK   status = "ok"
+	statusWarn status = "warn"
+	statusFail status = "fail"
+	statusSkip status = "skip"
+)
+
+// symbol is how the text report shows a status.
+func (s status) symbol() string {
+	switch s {
+	case statusOK:
+		return "✓"
+	case statusWarn:
+		return "!"
+	case statusFail:
+		return "✗"
+	default:
+		return "-"
+	}
+}
+
+// check is one line of the report. Fix tells how to remedy a warning or a
+// failure.
+type check struct {
+	Step   string `json:"step"`
+	Name   string `json:"name"`
+	Status status `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// report is the --print document.
+type report struct {
+	Checks   []check `json:"checks"`
+	Failed   int     `json:"failed"`
+	Warnings int     `json:"warnings"`
+}
+
+// diagnosis holds the inputs and what earlier steps learned, and collects
+// the report.
+type diagnosis struct {
+	ProjectNumber  string
+	PoolID         string
+	ProviderID     string
+	ServiceAccount string
+	AdminToken     string
+
+	// token is the subject token; header and claims are nil when it
+	// doesn't decode, with tokenErr saying why.
+	token    string
+	header   map[string]interface{}
+	claims   jwt.MapClaims
+	tokenErr error
+
+	// localKey is the public key from --public-key or --private-key, and
+	// localJWKS the --jwks file; either is nil when not given or invalid.
+	localKey  *rsa.PublicKey
+	localJWKS *jwks
+
+	// provider and pool are read with the admin token; providerErr is set
+	// when that failed.
+	pool        *pool
+	provider    *provider
+	providerErr error
+
+	// attributes are the mapped attributes (google.subject, attribute.*)
+	// that could be computed from the token.
+	attributes map[string]string
+
+	out    io.Writer // the text report; io.Discard with --print
+	step   string
+	report report
+}
+
+func setup(fs *flag.FlagSet) func() {
+	var d diagnosis
+	fs.StringVar(&d.ProjectNumber, "project-number", "", "GCP project number, not the project ID (required)")
+	fs.StringVar(&d.PoolID, "pool-id", "", "Workload Identity Pool ID (required)")
+	fs.StringVar(&d.ProviderID, "provider-id", "", "Identity Provider ID (required)")
+	fs.StringVar(&d.ServiceAccount, "service-account", "", "Service account the identity impersonates (the federated token is checked alone when empty)")
+	tokenPath := fs.String("token-input", "", "Path to the external JWT from create-jwt, - for stdin (required)")
+	privateKeyPath := fs.String("private-key", "", "Path to the private key PEM file the JWT was signed with")
+	publicKeyPath := fs.String("public-key", "", "Path to the public key PEM file from generate-keys")
+	jwksPath := fs.String("jwks", "", "Path to the JWKS file from generate-jwk, as uploaded to the provider")
+	adminTokenPath := fs.String("admin-token-input", "", "Path to an access token allowed to read the provider and the service account's IAM policy, - for stdin")
+	printFormat := fs.String("print", "", "Print only the report as json, yaml or table")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		if d.ProjectNumber == "" || d.PoolID == "" || d.ProviderID == "" || *tokenPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		d.out = os.Stdout
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+			d.out = io.Discard
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with the report.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		data, err := cli.ReadFile(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading subject token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run create-jwt first!")
+			os.Exit(1)
+		}
+		d.decodeToken(strings.TrimSpace(string(data)))
+
+		if *adminTokenPath != "" {
+			if d.AdminToken, err = cli.ReadAccessToken(*adminTokenPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading admin token: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ctx := context.Background()
+
+		fmt.Fprintln(cli.Log, "=== Diagnosing the Federation Setup ===")
+		fmt.Fprintf(cli.Log, "Provider: %s\n", d.providerName())
+		if d.ServiceAccount != "" {
+			fmt.Fprintf(cli.Log, "Service account: %s\n", d.ServiceAccount)
+		}
+		fmt.Fprintln(cli.Log)
+
+		// The provider's JWKS is the one STS verifies with, so read it
+		// before the JWT is checked.
+		if d.AdminToken != "" {
+			d.readProvider(ctx)
+		}
+
+		d.begin("1. Local keys")
+		d.checkKeys(*privateKeyPath, *publicKeyPath, *jwksPath)
+		d.begin("2. JWT")
+		d.checkToken(time.Now())
+		d.begin("3. Provider")
+		d.checkProvider()
+		d.begin("4. Service account binding")
+		d.checkBinding(ctx)
+		d.begin("5. Token exchange")
+		d.checkExchange(ctx)
+
+		d.printSummary()
+
+		if *printFormat != "" {
+			if err := d.writeReport(*printFormat); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if d.report.Failed > 0 {
+			os.Exit(2)
+		}
+	}
+}
+
+// providerName returns the provider's resource name, e.g.
+// "projects/123/locations/global/workloadIdentityPools/my-pool/providers/my-provider".
+func (d *diagnosis) providerName() string {
+	return d.poolName() + "/providers/" + d.ProviderID
+}
+
+func (d *diagnosis) poolName() string {
+	return fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s", d.ProjectNumber, d.PoolID)
+}
+
+// begin starts a step of the report.
+func (d *diagnosis) begin(step string) {
+	if d.step != "" {
+		fmt.Fprintln(d.out)
+	}
+	d.step = step
+	fmt.Fprintf(d.out, "=== %s ===\n", step)
+}
+
+// add records a check and prints it.
+func (d *diagnosis) add(name string, s status, detail, fix string) {
+	d.report.Checks = append(d.report.Checks, check{Step: d.step, Name: name, Status: s, Detail: detail, Fix: fix})
+	switch s {
+	case statusFail:
+		d.report.Failed++
+	case statusWarn:
+		d.report.Warnings++
+	}
+
+	fmt.Fprintf(d.out, "  %s %s: %s\n", s.symbol(), name, detail)
+	if fix != "" {
+		fmt.Fprintf(d.out, "      Fix: %s\n", strings.ReplaceAll(fix, "\n", "\n           "))
+	}
+}
+
+func (d *diagnosis) printSummary() {
+	counts := map[status]int{}
+	for _, c := range d.report.Checks {
+		counts[c.Status]++
+	}
+	fmt.Fprintln(d.out)
+	fmt.Fprintf(d.out, "Summary: %d ok, %d warning(s), %d failed, %d skipped\n",
+		counts[statusOK], counts[statusWarn], counts[statusFail], counts[statusSkip])
+	fmt.Fprintln(d.out, "✓ ok  ! warning  ✗ failed  - skipped")
+
+	fmt.Fprintln(cli.Log)
+	fmt.Fprintln(cli.Log, "=== Next Step ===")
+	if d.report.Failed > 0 {
+		fmt.Fprintln(cli.Log, "Fix the first failed check (later ones often follow from it), then run doctor again.")
+		return
+	}
+	fmt.Fprintln(cli.Log, "The setup works. Exchange tokens with:")
+	fmt.Fprintln(cli.Log)
+	fmt.Fprintf(cli.Log, "  ./bin/exchange-token --project-number %s --pool-id %s --provider-id %s --service-account %s --token-input <PATH> --output <PATH>\n",
+		d.ProjectNumber, d.PoolID, d.ProviderID, placeholder(d.ServiceAccount, "<SERVICE_ACCOUNT_EMAIL>"))
+}
+
+// writeReport prints the report in a machine-readable format; table has a
+// row per check.
+func (d *diagnosis) writeReport(format string) error {
+	if format != "table" {
+		return output.Document(os.Stdout, format, d.report)
+	}
+	rows := make([][]string, 0, len(d.report.Checks))
+	for _, c := range d.report.Checks {
+		rows = append(rows, []string{c.Step, c.Name, string(c.Status), c.Detail})
+	}
+	return output.Table(os.Stdout, []string{"STEP", "CHECK", "STATUS", "DETAIL"}, rows)
+}
+
+func placeholder(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
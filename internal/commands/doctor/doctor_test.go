@@ -0,0 +1,318 @@
+package doctor
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/sts"
+)
+
+const (
+	testProjectNumber  = "123456789"
+	testPoolID         = "pool"
+	testProviderID     = "provider"
+	testServiceAccount = "wif@my-project.iam.gserviceaccount.com"
+	testIssuer         = "https://idp.example.com"
+	testKID            = "key-1"
+	testAdminToken     = "admin-token"
+	testFederatedToken = "federated-token"
+)
+
+// signingKey signs the test JWTs; otherKey is an unrelated key.
+var signingKey, otherKey *rsa.PrivateKey
+
+func TestMain(m *testing.M) {
+	var err error
+	if signingKey, err = rsa.GenerateKey(rand.Reader, 2048); err == nil {
+		otherKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cli.Log = io.Discard
+	os.Exit(m.Run())
+}
+
+// testProviderName is the provider's resource name.
+var testProviderName = fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s/providers/%s", testProjectNumber, testPoolID, testProviderID)
+
+// validClaims are claims the default fake provider accepts.
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":         testIssuer,
+		"sub":         "alice",
+		"aud":         "https://iam.googleapis.com/" + testProviderName,
+		"iat":         now.Add(-time.Minute).Unix(),
+		"exp":         now.Add(time.Hour).Unix(),
+		"environment": "prod",
+	}
+}
+
+// mintJWT signs claims with key, naming kid in the header when not empty.
+func mintJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// jwksJSON returns a JWKS holding key under kid.
+func jwksJSON(key *rsa.PublicKey, kid string) string {
+	data, _ := json.Marshal(jwks{Keys: []jwk{{
+		Kid: kid,
+		Kty: "RSA",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	return string(data)
+}
+
+// writeFile writes data to name in a temporary directory and returns the
+// path.
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writePrivateKey(t *testing.T, key *rsa.PrivateKey) string {
+	return writeFile(t, "private_key.pem", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func writePublicKey(t *testing.T, key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "public_key.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// newDiagnosis returns a diagnosis of token with the test provider and
+// service account, reporting to nowhere.
+func newDiagnosis(token string) *diagnosis {
+	d := &diagnosis{
+		ProjectNumber:  testProjectNumber,
+		PoolID:         testPoolID,
+		ProviderID:     testProviderID,
+		ServiceAccount: testServiceAccount,
+		AdminToken:     testAdminToken,
+		out:            io.Discard,
+	}
+	d.decodeToken(token)
+	return d
+}
+
+// wantStatuses fails the test unless the named checks have the given
+// statuses.
+func wantStatuses(t *testing.T, d *diagnosis, want map[string]status) {
+	t.Helper()
+	got := map[string]status{}
+	for _, c := range d.report.Checks {
+		got[c.Name] = c.Status
+	}
+	for name, s := range want {
+		if got[name] != s {
+			t.Errorf("check %q is %q, want %q\nreport:\n%s", name, got[name], s, formatChecks(d.report.Checks))
+		}
+	}
+}
+
+// wantCheck returns the named check, failing the test when it's missing.
+func wantCheck(t *testing.T, d *diagnosis, name string) check {
+	t.Helper()
+	for _, c := range d.report.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %q check\nreport:\n%s", name, formatChecks(d.report.Checks))
+	return check{}
+}
+
+func formatChecks(checks []check) string {
+	var b strings.Builder
+	for _, c := range checks {
+		fmt.Fprintf(&b, "  %s %s: %s\n", c.Status, c.Name, c.Detail)
+	}
+	return b.String()
+}
+
+// fakeGCP serves the parts of the IAM, STS and IAM Credentials APIs doctor
+// calls. Nil resources answer 404.
+type fakeGCP struct {
+	pool     map[string]interface{}
+	provider map[string]interface{}
+	policy   map[string]interface{}
+
+	// stsError, when set, is the error_description of an invalid_grant.
+	stsError string
+	// impersonationStatus, when set, fails generateAccessToken.
+	impersonationStatus int
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// newFakeGCP returns a fake with an active pool and an OIDC provider that
+// accepts the tokens of validClaims signed with signingKey, and a policy
+// granting the whole pool.
+func newFakeGCP() *fakeGCP {
+	return &fakeGCP{
+		pool: map[string]interface{}{"name": "projects/" + testProjectNumber + "/locations/global/workloadIdentityPools/" + testPoolID, "state": "ACTIVE"},
+		provider: map[string]interface{}{
+			"name":  testProviderName,
+			"state": "ACTIVE",
+			"attributeMapping": map[string]string{
+				"google.subject":        "assertion.sub",
+				"attribute.environment": "assertion.environment",
+			},
+			"attributeCondition": "assertion.environment in ['prod', 'staging']",
+			"oidc": map[string]interface{}{
+				"issuerUri": testIssuer,
+				"jwksJson":  jwksJSON(&signingKey.PublicKey, testKID),
+			},
+		},
+		policy: policyGranting("principalSet://iam.googleapis.com/projects/" + testProjectNumber + "/locations/global/workloadIdentityPools/" + testPoolID + "/*"),
+	}
+}
+
+// policyGranting returns an IAM policy granting workloadIdentityUser to
+// members.
+func policyGranting(members ...string) map[string]interface{} {
+	return map[string]interface{}{"bindings": []interface{}{
+		map[string]interface{}{"role": "roles/iam.serviceAccountTokenCreator", "members": []string{"user:admin@example.com"}},
+		map[string]interface{}{"role": workloadIdentityUser, "members": members},
+	}}
+}
+
+// start serves the fake and points doctor's HTTP client at it.
+func (f *fakeGCP) start(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(f)
+	savedConfig, savedClient := netConfig, httpClient
+	t.Cleanup(func() {
+		server.Close()
+		netConfig, httpClient = savedConfig, savedClient
+	})
+
+	netConfig = httpclient.Config{EndpointBase: server.URL, MaxAttempts: 1}
+	var err error
+	if httpClient, err = netConfig.NewClient(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeGCP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.mu.Unlock()
+
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	path := r.URL.Path
+	switch {
+	case r.Method == "POST" && path == "/v1/token":
+		f.exchange(w, r)
+	case r.Method == "POST" && strings.HasSuffix(path, ":generateAccessToken"):
+		switch {
+		case bearer != testFederatedToken:
+			writeGoogleError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request had invalid authentication credentials.")
+		case f.impersonationStatus != 0:
+			writeGoogleError(w, f.impersonationStatus, "PERMISSION_DENIED", "Permission 'iam.serviceAccounts.getAccessToken' denied on resource (or it may not exist).")
+		default:
+			writeJSON(w, map[string]string{"accessToken": "sa-token", "expireTime": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)})
+		}
+	case bearer != testAdminToken:
+		writeGoogleError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request had invalid authentication credentials.")
+	case r.Method == "POST" && path == "/v1/projects/-/serviceAccounts/"+testServiceAccount+":getIamPolicy":
+		writeResource(w, f.policy)
+	case r.Method == "POST" && strings.HasSuffix(path, ":getIamPolicy"):
+		writeResource(w, nil)
+	case r.Method == "GET" && path == "/v1/"+testProviderName:
+		writeResource(w, f.provider)
+	case r.Method == "GET" && path == "/v1/projects/"+testProjectNumber+"/locations/global/workloadIdentityPools/"+testPoolID:
+		writeResource(w, f.pool)
+	default:
+		writeResource(w, nil)
+	}
+}
+
+// exchange answers an STS token exchange for the test provider's audience.
+func (f *fakeGCP) exchange(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	description := f.stsError
+	if want := sts.WorkloadAudience(testProjectNumber, testPoolID, testProviderID); r.PostForm.Get("audience") != want {
+		description = fmt.Sprintf("The audience %s is not %s.", r.PostForm.Get("audience"), want)
+	}
+	if description != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": description})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"access_token": testFederatedToken, "issued_token_type": sts.TokenTypeAccessToken, "token_type": "Bearer", "expires_in": 3600})
+}
+
+func writeResource(w http.ResponseWriter, resource map[string]interface{}) {
+	if resource == nil {
+		writeGoogleError(w, http.StatusNotFound, "NOT_FOUND", "Requested entity was not found.")
+		return
+	}
+	writeJSON(w, resource)
+}
+
+func writeGoogleError(w http.ResponseWriter, code int, status, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "message": message, "status": status}})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestReportCounts(t *testing.T) {
+	d := newDiagnosis("")
+	d.add("a", statusOK, "", "")
+	d.add("b", statusFail, "", "fix")
+	d.add("c", statusWarn, "", "")
+	d.add("d", statusSkip, "", "")
+	d.add("e", statusFail, "", "fix")
+	if d.report.Failed != 2 || d.report.Warnings != 1 {
+		t.Errorf("Failed = %d, Warnings = %d, want 2 and 1", d.report.Failed, d.report.Warnings)
+	}
+}
@@ -0,0 +1,50 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/iamcredentials"
+	"wif-poc/internal/sts"
+)
+
+// checkExchange performs the exchange exchange-token would, without saving
+// the tokens.
+func (d *diagnosis) checkExchange(ctx context.Context) {
+	if d.tokenErr != nil {
+		d.add("STS exchange", statusSkip, "the JWT doesn't decode", "")
+		return
+	}
+
+	stsClient := sts.Client{HTTP: httpClient, BaseURL: netConfig.ServiceURL("sts")}
+	fmt.Fprintf(cli.Log, "Exchanging the JWT at %s\n", stsClient.TokenURL())
+	federated, err := stsClient.Exchange(ctx, map[string]string{
+		"audience":           sts.WorkloadAudience(d.ProjectNumber, d.PoolID, d.ProviderID),
+		"scope":              sts.CloudPlatformScope,
+		"subject_token_type": sts.TokenTypeJWT,
+		"subject_token":      d.token,
+	})
+	if err != nil {
+		d.add("STS exchange", statusFail, err.Error(), fixFor(err, "Fix the failed checks above, then try again"))
+		if d.ServiceAccount != "" {
+			d.add("impersonation", statusSkip, "needs a federated token", "")
+		}
+		return
+	}
+	d.add("STS exchange", statusOK, fmt.Sprintf("federated token, expires in %s", time.Duration(federated.ExpiresIn)*time.Second), "")
+
+	if d.ServiceAccount == "" {
+		d.add("impersonation", statusSkip, "no --service-account", "")
+		return
+	}
+	iamClient := iamcredentials.Client{HTTP: httpClient, BaseURL: netConfig.ServiceURL("iamcredentials"), AccessToken: federated.AccessToken}
+	fmt.Fprintf(cli.Log, "Impersonating %s at %s\n", d.ServiceAccount, iamClient.MethodURL(d.ServiceAccount, "generateAccessToken"))
+	token, err := iamClient.GenerateAccessToken(ctx, d.ServiceAccount, []string{sts.CloudPlatformScope})
+	if err != nil {
+		d.add("impersonation", statusFail, err.Error(), fixFor(err, "Check the service account binding above"))
+		return
+	}
+	d.add("impersonation", statusOK, fmt.Sprintf("service account token, expires at %s", token.ExpireTime.Format(time.RFC3339)), "")
+}
@@ -0,0 +1,94 @@
+package doctor
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckExchange(t *testing.T) {
+	tests := []struct {
+		name  string
+		fake  func(f *fakeGCP)
+		setup func(d *diagnosis)
+		want  map[string]status
+	}{
+		{
+			name: "federated and impersonated",
+			want: map[string]status{"STS exchange": statusOK, "impersonation": statusOK},
+		},
+		{
+			name:  "federated token only",
+			setup: func(d *diagnosis) { d.ServiceAccount = "" },
+			want:  map[string]status{"STS exchange": statusOK, "impersonation": statusSkip},
+		},
+		{
+			name: "STS rejects the token",
+			fake: func(f *fakeGCP) { f.stsError = "The audience in ID Token [gcp] does not match the expected audience." },
+			want: map[string]status{"STS exchange": statusFail, "impersonation": statusSkip},
+		},
+		{
+			name:  "wrong project number",
+			setup: func(d *diagnosis) { d.ProjectNumber = "987654321" },
+			want:  map[string]status{"STS exchange": statusFail, "impersonation": statusSkip},
+		},
+		{
+			name: "impersonation denied",
+			fake: func(f *fakeGCP) { f.impersonationStatus = http.StatusForbidden },
+			want: map[string]status{"STS exchange": statusOK, "impersonation": statusFail},
+		},
+		{
+			name:  "token doesn't decode",
+			setup: func(d *diagnosis) { d.decodeToken("not-a-jwt") },
+			want:  map[string]status{"STS exchange": statusSkip},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGCP()
+			if tt.fake != nil {
+				tt.fake(f)
+			}
+			f.start(t)
+			d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+			if tt.setup != nil {
+				tt.setup(d)
+			}
+
+			d.checkExchange(context.Background())
+			wantStatuses(t, d, tt.want)
+			if len(d.report.Checks) != len(tt.want) {
+				t.Errorf("got %d checks, want %d:\n%s", len(d.report.Checks), len(tt.want), formatChecks(d.report.Checks))
+			}
+		})
+	}
+}
+
+func TestCheckExchangeRequests(t *testing.T) {
+	f := newFakeGCP()
+	f.start(t)
+	d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+	d.checkExchange(context.Background())
+
+	want := []string{
+		"POST /v1/token",
+		"POST /v1/projects/-/serviceAccounts/" + testServiceAccount + ":generateAccessToken",
+	}
+	if strings.Join(f.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(f.requests, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckExchangeHint(t *testing.T) {
+	f := newFakeGCP()
+	f.impersonationStatus = http.StatusForbidden
+	f.start(t)
+	d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+	d.checkExchange(context.Background())
+
+	c := wantCheck(t, d, "impersonation")
+	if c.Fix == "" {
+		t.Errorf("impersonation failed without a fix: %q", c.Detail)
+	}
+}
@@ -0,0 +1,161 @@
+package doctor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The provider's attribute mapping and condition are CEL. doctor evaluates
+// the small subset that covers most setups: assertion.claim paths, string
+// literals, lists of literals, ==, !=, in and clauses joined with &&.
+// Anything else is reported as not checked rather than guessed at.
+
+// errUnsupported marks an expression outside the subset.
+type errUnsupported struct{ expr string }
+
+func (e errUnsupported) Error() string {
+	return fmt.Sprintf("can't evaluate %q locally", e.expr)
+}
+
+// evalValue evaluates a claim path or a literal against the claims.
+func evalValue(expr string, claims map[string]interface{}) (interface{}, error) {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case expr == "true" || expr == "false":
+		return expr == "true", nil
+	case len(expr) >= 2 && (expr[0] == '\'' || expr[0] == '"') && expr[len(expr)-1] == expr[0]:
+		return expr[1 : len(expr)-1], nil
+	case strings.HasPrefix(expr, "[") && strings.HasSuffix(expr, "]"):
+		var list []interface{}
+		for _, item := range splitOutside(expr[1:len(expr)-1], ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			value, err := evalValue(item, claims)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case strings.HasPrefix(expr, "assertion."):
+		fields := strings.Split(strings.TrimPrefix(expr, "assertion."), ".")
+		for _, field := range fields {
+			if !isIdentifier(field) {
+				return nil, errUnsupported{expr}
+			}
+		}
+		var value interface{} = claims
+		for _, field := range fields {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: the token has no such claim", expr)
+			}
+			if value, ok = object[field]; !ok {
+				return nil, fmt.Errorf("%s: the token has no such claim", expr)
+			}
+		}
+		return value, nil
+	}
+	return nil, errUnsupported{expr}
+}
+
+// evalCondition evaluates an attribute condition.
+func evalCondition(expr string, claims map[string]interface{}) (bool, error) {
+	if len(splitOutside(expr, "||")) > 1 {
+		return false, errUnsupported{expr}
+	}
+	for _, clause := range splitOutside(expr, "&&") {
+		ok, err := evalClause(strings.TrimSpace(clause), claims)
+		if err != nil || !ok {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+func evalClause(clause string, claims map[string]interface{}) (bool, error) {
+	for _, op := range []string{"==", "!=", " in "} {
+		parts := splitOutside(clause, op)
+		if len(parts) == 1 {
+			continue
+		}
+		if len(parts) != 2 {
+			return false, errUnsupported{clause}
+		}
+		left, err := evalValue(parts[0], claims)
+		if err != nil {
+			return false, err
+		}
+		right, err := evalValue(parts[1], claims)
+		if err != nil {
+			return false, err
+		}
+		switch op {
+		case "==":
+			return fmt.Sprint(left) == fmt.Sprint(right), nil
+		case "!=":
+			return fmt.Sprint(left) != fmt.Sprint(right), nil
+		default:
+			list, ok := right.([]interface{})
+			if !ok {
+				return false, fmt.Errorf("%s: the right side of in is not a list", clause)
+			}
+			for _, item := range list {
+				if fmt.Sprint(item) == fmt.Sprint(left) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+	value, err := evalValue(clause, claims)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, errUnsupported{clause}
+	}
+	return b, nil
+}
+
+// splitOutside splits s at sep where sep is outside quotes, brackets and
+// parentheses.
+func splitOutside(s, sep string) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package doctor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var exprClaims = map[string]interface{}{
+	"sub":         "alice",
+	"environment": "prod",
+	"admin":       true,
+	"count":       float64(3),
+	"groups":      []interface{}{"dev", "ops"},
+	"repository": map[string]interface{}{
+		"owner": "my-org",
+		"name":  "my-repo",
+	},
+}
+
+func TestEvalValue(t *testing.T) {
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"assertion.sub", "alice"},
+		{"  assertion.environment ", "prod"},
+		{"assertion.repository.owner", "my-org"},
+		{"assertion.admin", true},
+		{"assertion.groups", []interface{}{"dev", "ops"}},
+		{"'prod'", "prod"},
+		{`"prod"`, "prod"},
+		{"''", ""},
+		{"'a, b'", "a, b"},
+		{"true", true},
+		{"false", false},
+		{"['prod', 'staging']", []interface{}{"prod", "staging"}},
+		{"['a, b', assertion.sub]", []interface{}{"a, b", "alice"}},
+		{"[]", []interface{}(nil)},
+	}
+	for _, tt := range tests {
+		got, err := evalValue(tt.expr, exprClaims)
+		if err != nil {
+			t.Errorf("evalValue(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("evalValue(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalValueErrors(t *testing.T) {
+	tests := []struct {
+		expr        string
+		unsupported bool
+	}{
+		{"assertion.email", false},
+		{"assertion.sub.name", false},
+		{"assertion.repository.branch", false},
+		{"assertion['sub']", true},
+		{"assertion.groups[0]", true},
+		{"assertion.sub.lower()", true},
+		{"assertion.", true},
+		{"'sub::' + assertion.sub", true},
+		{"google.subject", true},
+		{"42", true},
+		{"'unterminated", true},
+		{"[assertion.email]", false},
+	}
+	for _, tt := range tests {
+		_, err := evalValue(tt.expr, exprClaims)
+		if err == nil {
+			t.Errorf("evalValue(%q) succeeded, want an error", tt.expr)
+			continue
+		}
+		var unsupported errUnsupported
+		if errors.As(err, &unsupported) != tt.unsupported {
+			t.Errorf("evalValue(%q) error = %v, unsupported %v, want %v", tt.expr, err, !tt.unsupported, tt.unsupported)
+		}
+	}
+}
+
+func TestEvalCondition(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"assertion.environment == 'prod'", true},
+		{"assertion.environment == 'dev'", false},
+		{"assertion.environment != 'dev'", true},
+		{"'prod' == assertion.environment", true},
+		{"assertion.environment in ['prod', 'staging']", true},
+		{"assertion.environment in ['dev', 'staging']", false},
+		{"assertion.environment in []", false},
+		{"assertion.repository.owner == 'my-org' && assertion.environment in ['prod']", true},
+		{"assertion.repository.owner == 'my-org' && assertion.environment == 'dev'", false},
+		{"assertion.admin", true},
+		{"assertion.admin == true", true},
+		{"assertion.count == '3'", true},
+		{"assertion.sub == 'a == b'", false},
+		{"assertion.sub == 'alice && bob'", false},
+		{"assertion.sub in ['x || y', 'alice']", true},
+	}
+	for _, tt := range tests {
+		got, err := evalCondition(tt.expr, exprClaims)
+		if err != nil {
+			t.Errorf("evalCondition(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("evalCondition(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalConditionErrors(t *testing.T) {
+	tests := []struct {
+		expr        string
+		unsupported bool
+	}{
+		{"assertion.environment == 'prod' || assertion.environment == 'staging'", true},
+		{"assertion.environment.startsWith('pr')", true},
+		{"'dev' in assertion.groups.map(g, g)", true},
+		{"assertion.sub == 'a' == 'b'", true},
+		{"assertion.sub", true},
+		{"size(assertion.sub) > 0", true},
+		{"assertion.email == 'alice@example.com'", false},
+		{"assertion.environment in 'prod'", false},
+		{"assertion.environment == 'prod' && assertion.email == ''", false},
+	}
+	for _, tt := range tests {
+		_, err := evalCondition(tt.expr, exprClaims)
+		if err == nil {
+			t.Errorf("evalCondition(%q) succeeded, want an error", tt.expr)
+			continue
+		}
+		var unsupported errUnsupported
+		if errors.As(err, &unsupported) != tt.unsupported {
+			t.Errorf("evalCondition(%q) error = %v, unsupported %v, want %v", tt.expr, err, !tt.unsupported, tt.unsupported)
+		}
+	}
+}
+
+func TestEvalConditionStopsAtFalseClause(t *testing.T) {
+	// The second clause would fail, but the first is already false.
+	got, err := evalCondition("assertion.environment == 'dev' && assertion.email == ''", exprClaims)
+	if err != nil || got {
+		t.Errorf("evalCondition() = %v, %v; want false, nil", got, err)
+	}
+}
+
+func TestSplitOutside(t *testing.T) {
+	tests := []struct {
+		s, sep string
+		want   []string
+	}{
+		{"a && b", "&&", []string{"a ", " b"}},
+		{"a", "&&", []string{"a"}},
+		{"'a && b' && c", "&&", []string{"'a && b' ", " c"}},
+		{`"a, b", c`, ",", []string{`"a, b"`, " c"}},
+		{"[a, b], c", ",", []string{"[a, b]", " c"}},
+		{"f(a, b), c", ",", []string{"f(a, b)", " c"}},
+		{"a == b == c", "==", []string{"a ", " b ", " c"}},
+	}
+	for _, tt := range tests {
+		if got := splitOutside(tt.s, tt.sep); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitOutside(%q, %q) = %q, want %q", tt.s, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	tests := map[string]bool{
+		"sub":         true,
+		"_private":    true,
+		"claim2":      true,
+		"repo_owner":  true,
+		"":            false,
+		"2claim":      false,
+		"groups[0]":   false,
+		"sub()":       false,
+		"with-dashes": false,
+	}
+	for s, want := range tests {
+		if got := isIdentifier(s); got != want {
+			t.Errorf("isIdentifier(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
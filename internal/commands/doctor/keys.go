@@ -0,0 +1,184 @@
+package doctor
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"wif-poc/internal/keys"
+)
+
+// jwk is an RSA key of a JWKS, as written by generate-jwk and k8s-jwks.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func parseJWKS(data []byte) (*jwks, error) {
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("not a JWKS: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("the JWKS has no keys")
+	}
+	return &set, nil
+}
+
+// find returns the key with the given kid, or nil.
+func (s *jwks) find(kid string) *jwk {
+	for i := range s.Keys {
+		if s.Keys[i].Kid == kid {
+			return &s.Keys[i]
+		}
+	}
+	return nil
+}
+
+// kids lists the key IDs, for messages.
+func (s *jwks) kids() string {
+	ids := make([]string, 0, len(s.Keys))
+	for _, k := range s.Keys {
+		ids = append(ids, fmt.Sprintf("%q", k.Kid))
+	}
+	return strings.Join(ids, ", ")
+}
+
+// publicKey decodes the key's modulus and exponent.
+func (k *jwk) publicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("key %q has kty %q, expected RSA", k.Kid, k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("key %q has an invalid modulus: %w", k.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("key %q has an invalid exponent: %w", k.Kid, err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// checkKeys checks that the local key files belong together and that the
+// JWKS holds the key the JWT names.
+func (d *diagnosis) checkKeys(privateKeyPath, publicKeyPath, jwksPath string) {
+	if privateKeyPath == "" && publicKeyPath == "" && jwksPath == "" {
+		d.add("local keys", statusSkip, "no --private-key, --public-key or --jwks given", "")
+		return
+	}
+
+	var privateKey *rsa.PrivateKey
+	if privateKeyPath != "" {
+		key, err := keys.LoadPrivateKey(privateKeyPath)
+		if err != nil {
+			d.add("private key", statusFail, err.Error(), "Generate a key pair with generate-keys")
+		} else {
+			privateKey = key
+			d.add("private key", keySizeStatus(key.N), fmt.Sprintf("%s: RSA %d bits", privateKeyPath, key.N.BitLen()), keySizeFix(key.N))
+			d.localKey = &key.PublicKey
+		}
+	}
+
+	if publicKeyPath != "" {
+		key, err := keys.LoadPublicKey(publicKeyPath)
+		if err != nil {
+			d.add("public key", statusFail, err.Error(), "Generate a key pair with generate-keys")
+		} else {
+			d.add("public key", statusOK, fmt.Sprintf("%s: RSA %d bits", publicKeyPath, key.N.BitLen()), "")
+			if privateKey != nil {
+				if key.Equal(&privateKey.PublicKey) {
+					d.add("key pair", statusOK, fmt.Sprintf("%s is the public half of %s", publicKeyPath, privateKeyPath), "")
+				} else {
+					d.add("key pair", statusFail, fmt.Sprintf("%s is not the public half of %s", publicKeyPath, privateKeyPath),
+						"Use the pair written together by generate-keys, then regenerate the JWKS with generate-jwk and update the provider")
+				}
+			}
+			d.localKey = key
+		}
+	}
+
+	if jwksPath == "" {
+		return
+	}
+	data, err := os.ReadFile(jwksPath)
+	if err == nil {
+		d.localJWKS, err = parseJWKS(data)
+	}
+	if err != nil {
+		d.add("JWKS", statusFail, fmt.Sprintf("%s: %v", jwksPath, err), "Create it with generate-jwk")
+		return
+	}
+	d.add("JWKS", statusOK, fmt.Sprintf("%s: key ID(s) %s", jwksPath, d.localJWKS.kids()), "")
+	d.checkJWKSKey("JWKS key", jwksPath, d.localJWKS,
+		fmt.Sprintf("Regenerate it from the signing key: generate-jwk --key-id %s --public-key <PATH> --jwk-output <PATH> --jwks-output %s", placeholder(d.kid(), "<KEY_ID>"), jwksPath))
+}
+
+// checkJWKSKey checks that set has the JWT's kid and that the key is the
+// local one. fix tells how to correct the JWKS.
+func (d *diagnosis) checkJWKSKey(name, source string, set *jwks, fix string) {
+	kid := d.kid()
+	if d.header == nil {
+		d.add(name, statusSkip, "the JWT doesn't decode, so its kid is unknown", "")
+		return
+	}
+	if kid == "" {
+		d.add(name, statusFail, "the JWT has no kid header, so no key of the JWKS can be picked",
+			"Mint the JWT with create-jwt --key-id <KEY_ID> using a key ID of the JWKS")
+		return
+	}
+	key := set.find(kid)
+	if key == nil {
+		d.add(name, statusFail, fmt.Sprintf("the JWT's kid %q is not in %s (it has %s)", kid, source, set.kids()),
+			fmt.Sprintf("Mint the JWT with create-jwt --key-id set to a key ID of the JWKS, or %s", lowerFirst(fix)))
+		return
+	}
+	publicKey, err := key.publicKey()
+	if err != nil {
+		d.add(name, statusFail, err.Error(), fix)
+		return
+	}
+	if d.localKey == nil {
+		d.add(name, statusOK, fmt.Sprintf("%s has the JWT's kid %q (not compared with a local key)", source, kid), "")
+		return
+	}
+	if !publicKey.Equal(d.localKey) {
+		d.add(name, statusFail, fmt.Sprintf("key %q in %s has a different modulus or exponent than the local key", kid, source), fix)
+		return
+	}
+	d.add(name, statusOK, fmt.Sprintf("key %q in %s matches the local key", kid, source), "")
+}
+
+// keySizeStatus warns about keys shorter than the 2048 bits GCP expects.
+func keySizeStatus(n *big.Int) status {
+	if n.BitLen() < 2048 {
+		return statusWarn
+	}
+	return statusOK
+}
+
+func keySizeFix(n *big.Int) string {
+	if n.BitLen() < 2048 {
+		return "Generate a new key pair with generate-keys, which creates 2048-bit keys"
+	}
+	return ""
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
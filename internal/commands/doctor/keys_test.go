@@ -0,0 +1,95 @@
+package doctor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckKeys(t *testing.T) {
+	token := func(t *testing.T) string { return mintJWT(t, signingKey, testKID, validClaims()) }
+	tests := []struct {
+		name  string
+		files func(t *testing.T) (privateKey, publicKey, jwksPath string)
+		want  map[string]status
+	}{
+		{
+			name:  "no files",
+			files: func(t *testing.T) (string, string, string) { return "", "", "" },
+			want:  map[string]status{"local keys": statusSkip},
+		},
+		{
+			name: "matching pair and JWKS",
+			files: func(t *testing.T) (string, string, string) {
+				return writePrivateKey(t, signingKey), writePublicKey(t, &signingKey.PublicKey),
+					writeFile(t, "public_key.jwks", []byte(jwksJSON(&signingKey.PublicKey, testKID)))
+			},
+			want: map[string]status{"private key": statusOK, "public key": statusOK, "key pair": statusOK, "JWKS": statusOK, "JWKS key": statusOK},
+		},
+		{
+			name: "public key of another pair",
+			files: func(t *testing.T) (string, string, string) {
+				return writePrivateKey(t, signingKey), writePublicKey(t, &otherKey.PublicKey), ""
+			},
+			want: map[string]status{"private key": statusOK, "public key": statusOK, "key pair": statusFail},
+		},
+		{
+			name: "JWKS without the JWT's kid",
+			files: func(t *testing.T) (string, string, string) {
+				return "", writePublicKey(t, &signingKey.PublicKey), writeFile(t, "public_key.jwks", []byte(jwksJSON(&signingKey.PublicKey, "key-2")))
+			},
+			want: map[string]status{"public key": statusOK, "JWKS": statusOK, "JWKS key": statusFail},
+		},
+		{
+			name: "JWKS of another key",
+			files: func(t *testing.T) (string, string, string) {
+				return writePrivateKey(t, signingKey), "", writeFile(t, "public_key.jwks", []byte(jwksJSON(&otherKey.PublicKey, testKID)))
+			},
+			want: map[string]status{"private key": statusOK, "JWKS": statusOK, "JWKS key": statusFail},
+		},
+		{
+			name: "JWKS alone",
+			files: func(t *testing.T) (string, string, string) {
+				return "", "", writeFile(t, "public_key.jwks", []byte(jwksJSON(&signingKey.PublicKey, testKID)))
+			},
+			want: map[string]status{"JWKS": statusOK, "JWKS key": statusOK},
+		},
+		{
+			name: "invalid files",
+			files: func(t *testing.T) (string, string, string) {
+				return filepath.Join(t.TempDir(), "missing.pem"), writeFile(t, "public_key.pem", []byte("not PEM")),
+					writeFile(t, "public_key.jwks", []byte(`{"keys": []}`))
+			},
+			want: map[string]status{"private key": statusFail, "public key": statusFail, "JWKS": statusFail},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDiagnosis(token(t))
+			d.checkKeys(tt.files(t))
+			wantStatuses(t, d, tt.want)
+		})
+	}
+}
+
+func TestCheckKeysSetsLocalKey(t *testing.T) {
+	d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+	d.checkKeys(writePrivateKey(t, signingKey), "", "")
+	if d.localKey == nil || !d.localKey.Equal(&signingKey.PublicKey) {
+		t.Fatalf("localKey = %v, want the public half of the private key", d.localKey)
+	}
+}
+
+func TestCheckKeysWrongKIDFix(t *testing.T) {
+	d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+	jwksPath := writeFile(t, "public_key.jwks", []byte(jwksJSON(&signingKey.PublicKey, "key-2")))
+	d.checkKeys("", "", jwksPath)
+
+	c := wantCheck(t, d, "JWKS key")
+	if !strings.Contains(c.Detail, `"key-1"`) || !strings.Contains(c.Detail, `"key-2"`) {
+		t.Errorf("detail %q should name the JWT's kid and the JWKS's", c.Detail)
+	}
+	if !strings.Contains(c.Fix, "--key-id") || !strings.Contains(c.Fix, "generate-jwk --key-id key-1") {
+		t.Errorf("fix %q should suggest both create-jwt --key-id and regenerating the JWKS", c.Fix)
+	}
+}
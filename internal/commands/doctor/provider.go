@@ -0,0 +1,238 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"wif-poc/internal/apierror"
+	"wif-poc/internal/cli"
+)
+
+// maxSubjectLength is the most bytes google.subject may have.
+const maxSubjectLength = 127
+
+// pool is the part of a workload identity pool doctor checks.
+type pool struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Disabled bool   `json:"disabled"`
+}
+
+// provider is the part of a workload identity pool provider doctor checks.
+type provider struct {
+	Name               string            `json:"name"`
+	State              string            `json:"state"`
+	Disabled           bool              `json:"disabled"`
+	AttributeMapping   map[string]string `json:"attributeMapping"`
+	AttributeCondition string            `json:"attributeCondition"`
+	OIDC               *struct {
+		IssuerURI        string   `json:"issuerUri"`
+		AllowedAudiences []string `json:"allowedAudiences"`
+		JWKSJSON         string   `json:"jwksJson"`
+	} `json:"oidc"`
+}
+
+// readProvider reads the pool and the provider with the admin token.
+func (d *diagnosis) readProvider(ctx context.Context) {
+	base := netConfig.ServiceURL("iam") + "/v1/"
+	fmt.Fprintf(cli.Log, "Reading %s\n", d.providerName())
+
+	var p pool
+	if err := httpClient.CallJSON(ctx, "IAM", "GET", base+d.poolName(), d.AdminToken, nil, &p); err != nil {
+		d.providerErr = fmt.Errorf("failed to read the pool: %w", err)
+		return
+	}
+	d.pool = &p
+
+	var pr provider
+	if err := httpClient.CallJSON(ctx, "IAM", "GET", base+d.providerName(), d.AdminToken, nil, &pr); err != nil {
+		d.providerErr = fmt.Errorf("failed to read the provider: %w", err)
+		return
+	}
+	d.provider = &pr
+}
+
+// checkProvider compares the provider's configuration with the JWT.
+func (d *diagnosis) checkProvider() {
+	if d.AdminToken == "" {
+		d.add("provider", statusSkip, "no --admin-token-input, so the provider can't be read",
+			"Pass a token that may read the provider, e.g.: gcloud auth print-access-token > admin_token.txt")
+		return
+	}
+	if d.providerErr != nil {
+		fix := "Check that the admin token is valid and may read the provider (roles/iam.workloadIdentityPoolViewer)"
+		if isNotFound(d.providerErr) {
+			fix = (&apierror.Error{Kind: apierror.KindPoolNotFound}).Hint()
+		}
+		d.add("provider", statusFail, d.providerErr.Error(), fixFor(d.providerErr, fix))
+		return
+	}
+
+	d.checkState("pool", d.pool.State, d.pool.Disabled,
+		fmt.Sprintf("gcloud iam workload-identity-pools update %s --location=global --no-disabled", d.PoolID))
+	d.checkState("provider", d.provider.State, d.provider.Disabled,
+		fmt.Sprintf("gcloud iam workload-identity-pools providers update-oidc %s --workload-identity-pool=%s --location=global --no-disabled", d.ProviderID, d.PoolID))
+
+	oidc := d.provider.OIDC
+	if oidc == nil {
+		d.add("type", statusFail, "the provider is not an OIDC provider, so it doesn't accept JWTs",
+			"Create an OIDC provider with gcloud iam workload-identity-pools providers create-oidc")
+		return
+	}
+	if d.claims == nil {
+		d.add("token", statusSkip, "the JWT doesn't decode, so it can't be compared with the provider", "")
+		return
+	}
+	update := fmt.Sprintf("gcloud iam workload-identity-pools providers update-oidc %s --workload-identity-pool=%s --location=global", d.ProviderID, d.PoolID)
+
+	if iss := d.claim("iss"); iss == oidc.IssuerURI {
+		d.add("issuer", statusOK, fmt.Sprintf("iss matches the issuer URI %q", iss), "")
+	} else {
+		d.add("issuer", statusFail, fmt.Sprintf("iss is %q but the provider's issuer URI is %q", iss, oidc.IssuerURI),
+			fmt.Sprintf("Mint the JWT with create-jwt --issuer %s, or run:\n%s --issuer-uri=%s", oidc.IssuerURI, update, iss))
+	}
+
+	d.checkAudience(oidc.AllowedAudiences, update)
+	d.checkMapping()
+	d.checkCondition()
+
+	if oidc.JWKSJSON == "" {
+		d.add("JWKS", statusSkip, fmt.Sprintf("no JWKS uploaded; STS fetches keys from %s/.well-known/openid-configuration", strings.TrimSuffix(oidc.IssuerURI, "/")),
+			"")
+		return
+	}
+	set, err := parseJWKS([]byte(oidc.JWKSJSON))
+	if err != nil {
+		d.add("JWKS", statusFail, fmt.Sprintf("the provider's JWKS is invalid: %v", err), update+" --jwk-json-path=public_key.jwks")
+		return
+	}
+	d.checkJWKSKey("JWKS", "the provider's JWKS", set, "Upload the JWKS of the signing key: "+update+" --jwk-json-path=public_key.jwks")
+}
+
+func (d *diagnosis) checkState(name, state string, disabled bool, fix string) {
+	switch {
+	case state != "ACTIVE":
+		d.add(name, statusFail, fmt.Sprintf("the %s is %s", name, state),
+			fmt.Sprintf("Undelete the %s within 30 days, or create it again", name))
+	case disabled:
+		d.add(name, statusFail, fmt.Sprintf("the %s is disabled", name), fix)
+	default:
+		d.add(name, statusOK, "active", "")
+	}
+}
+
+// checkAudience checks aud against the allowed audiences, which default to
+// the provider's full resource name, with or without the https: scheme.
+func (d *diagnosis) checkAudience(allowed []string, update string) {
+	if len(allowed) == 0 {
+		allowed = []string{"https://iam.googleapis.com/" + d.providerName(), "//iam.googleapis.com/" + d.providerName()}
+	}
+	audiences, _ := d.claims.GetAudience()
+	for _, aud := range audiences {
+		for _, a := range allowed {
+			if aud == a {
+				d.add("audience", statusOK, fmt.Sprintf("aud %q is allowed", aud), "")
+				return
+			}
+		}
+	}
+	d.add("audience", statusFail, fmt.Sprintf("aud %q is not among the allowed audiences %q", []string(audiences), allowed),
+		fmt.Sprintf("Mint the JWT with create-jwt --audience %s, or run:\n%s --allowed-audiences=%s", allowed[0], update, placeholder(strings.Join(audiences, ","), "<AUDIENCE>")))
+}
+
+// checkMapping evaluates the attribute mapping and keeps the attributes for
+// the binding check.
+func (d *diagnosis) checkMapping() {
+	const fix = "Set --attribute-mapping=google.subject=assertion.sub (or another claim that is present and short)"
+
+	d.attributes = map[string]string{}
+	expr, ok := d.provider.AttributeMapping["google.subject"]
+	if !ok {
+		d.add("google.subject", statusFail, "the attribute mapping has no google.subject", fix)
+		return
+	}
+
+	var unchecked []string
+	names := make([]string, 0, len(d.provider.AttributeMapping))
+	for name := range d.provider.AttributeMapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := evalValue(d.provider.AttributeMapping[name], d.claims)
+		var unsupported errUnsupported
+		switch {
+		case errors.As(err, &unsupported):
+			if name != "google.subject" {
+				unchecked = append(unchecked, name)
+			}
+			continue
+		case err != nil && name == "google.subject":
+			d.add("google.subject", statusFail, err.Error(), fix)
+			return
+		case err != nil:
+			// A missing claim leaves the attribute unset, which STS allows.
+			continue
+		}
+		d.attributes[name] = fmt.Sprint(value)
+	}
+
+	subject, ok := d.attributes["google.subject"]
+	switch {
+	case !ok:
+		d.add("google.subject", statusWarn, fmt.Sprintf("%s (not checked)", errUnsupported{expr}), "")
+	case subject == "":
+		d.add("google.subject", statusFail, fmt.Sprintf("%s is empty for this token", expr), fix)
+	case len(subject) > maxSubjectLength:
+		d.add("google.subject", statusFail, fmt.Sprintf("%s is %d bytes; google.subject may have at most %d", expr, len(subject), maxSubjectLength),
+			"Map google.subject to a shorter claim")
+	default:
+		d.add("google.subject", statusOK, fmt.Sprintf("%s = %q", expr, subject), "")
+	}
+	if len(unchecked) > 0 {
+		d.add("attribute mapping", statusWarn, fmt.Sprintf("can't evaluate %s locally", strings.Join(unchecked, ", ")), "")
+	}
+}
+
+// checkCondition evaluates the attribute condition against the claims.
+func (d *diagnosis) checkCondition() {
+	condition := d.provider.AttributeCondition
+	if condition == "" {
+		d.add("condition", statusOK, "no attribute condition", "")
+		return
+	}
+	ok, err := evalCondition(condition, d.claims)
+	var unsupported errUnsupported
+	switch {
+	case errors.As(err, &unsupported):
+		d.add("condition", statusWarn, fmt.Sprintf("%q: %v (not checked)", condition, err), "")
+	case err != nil:
+		d.add("condition", statusFail, fmt.Sprintf("%q: %v", condition, err),
+			"Mint the JWT with the claims the condition needs, or change --attribute-condition")
+	case !ok:
+		d.add("condition", statusFail, fmt.Sprintf("%q is false for this token", condition),
+			"Mint the JWT with claims that satisfy the condition (e.g. create-jwt --environment), or change --attribute-condition")
+	default:
+		d.add("condition", statusOK, fmt.Sprintf("%q is true for this token", condition), "")
+	}
+}
+
+// fixFor returns the API error's hint, or fallback.
+func fixFor(err error, fallback string) string {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		if hint := apiErr.Hint(); hint != "" {
+			return hint
+		}
+	}
+	return fallback
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apierror.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
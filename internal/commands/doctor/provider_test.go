@@ -0,0 +1,218 @@
+package doctor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		fake   func(f *fakeGCP)
+		claims func(c jwt.MapClaims)
+		want   map[string]status
+	}{
+		{
+			name: "matching",
+			want: map[string]status{
+				"pool": statusOK, "provider": statusOK, "issuer": statusOK, "audience": statusOK,
+				"google.subject": statusOK, "condition": statusOK, "JWKS": statusOK,
+			},
+		},
+		{
+			name:   "audience without https:",
+			claims: func(c jwt.MapClaims) { c["aud"] = "//iam.googleapis.com/" + testProviderName },
+			want:   map[string]status{"audience": statusOK},
+		},
+		{
+			name: "audience of another provider",
+			claims: func(c jwt.MapClaims) {
+				c["aud"] = "https://iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/p"
+			},
+			want: map[string]status{"issuer": statusOK, "audience": statusFail},
+		},
+		{
+			name: "allowed audiences",
+			fake: func(f *fakeGCP) {
+				f.provider["oidc"].(map[string]interface{})["allowedAudiences"] = []string{"gcp-workload-identity"}
+			},
+			claims: func(c jwt.MapClaims) { c["aud"] = []string{"other", "gcp-workload-identity"} },
+			want:   map[string]status{"audience": statusOK},
+		},
+		{
+			name: "default audience not allowed",
+			fake: func(f *fakeGCP) {
+				f.provider["oidc"].(map[string]interface{})["allowedAudiences"] = []string{"gcp-workload-identity"}
+			},
+			want: map[string]status{"audience": statusFail},
+		},
+		{
+			name:   "wrong issuer",
+			claims: func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" },
+			want:   map[string]status{"issuer": statusFail, "audience": statusOK},
+		},
+		{
+			name: "disabled provider",
+			fake: func(f *fakeGCP) { f.provider["disabled"] = true },
+			want: map[string]status{"pool": statusOK, "provider": statusFail},
+		},
+		{
+			name: "deleted pool",
+			fake: func(f *fakeGCP) { f.pool["state"] = "DELETED" },
+			want: map[string]status{"pool": statusFail, "provider": statusOK},
+		},
+		{
+			name: "SAML provider",
+			fake: func(f *fakeGCP) {
+				delete(f.provider, "oidc")
+				f.provider["saml"] = map[string]string{"idpMetadataXml": "<xml/>"}
+			},
+			want: map[string]status{"provider": statusOK, "type": statusFail},
+		},
+		{
+			name:   "subject claim missing",
+			claims: func(c jwt.MapClaims) { delete(c, "sub") },
+			want:   map[string]status{"google.subject": statusFail},
+		},
+		{
+			name: "no google.subject mapping",
+			fake: func(f *fakeGCP) {
+				f.provider["attributeMapping"] = map[string]string{"attribute.environment": "assertion.environment"}
+			},
+			want: map[string]status{"google.subject": statusFail},
+		},
+		{
+			name: "subject too long",
+			claims: func(c jwt.MapClaims) {
+				c["sub"] = strings.Repeat("a", maxSubjectLength+1)
+			},
+			want: map[string]status{"google.subject": statusFail},
+		},
+		{
+			name: "mapping outside the CEL subset",
+			fake: func(f *fakeGCP) {
+				f.provider["attributeMapping"] = map[string]string{
+					"google.subject": "'sub::' + assertion.sub",
+					"attribute.team": "assertion.groups[0]",
+				}
+			},
+			want: map[string]status{"google.subject": statusWarn, "attribute mapping": statusWarn},
+		},
+		{
+			name:   "condition false",
+			claims: func(c jwt.MapClaims) { c["environment"] = "dev" },
+			want:   map[string]status{"condition": statusFail},
+		},
+		{
+			name:   "condition on a missing claim",
+			claims: func(c jwt.MapClaims) { delete(c, "environment") },
+			want:   map[string]status{"google.subject": statusOK, "condition": statusFail},
+		},
+		{
+			name: "condition outside the CEL subset",
+			fake: func(f *fakeGCP) { f.provider["attributeCondition"] = "assertion.environment.startsWith('pr')" },
+			want: map[string]status{"condition": statusWarn},
+		},
+		{
+			name: "no condition",
+			fake: func(f *fakeGCP) { delete(f.provider, "attributeCondition") },
+			want: map[string]status{"condition": statusOK},
+		},
+		{
+			name: "uploaded JWKS of another key",
+			fake: func(f *fakeGCP) {
+				f.provider["oidc"].(map[string]interface{})["jwksJson"] = jwksJSON(&otherKey.PublicKey, testKID)
+			},
+			want: map[string]status{"JWKS": statusFail},
+		},
+		{
+			name: "no uploaded JWKS",
+			fake: func(f *fakeGCP) { delete(f.provider["oidc"].(map[string]interface{}), "jwksJson") },
+			want: map[string]status{"JWKS": statusSkip},
+		},
+		{
+			name: "pool not found",
+			fake: func(f *fakeGCP) { f.pool = nil },
+			want: map[string]status{"provider": statusFail},
+		},
+		{
+			name: "provider not found",
+			fake: func(f *fakeGCP) { f.provider = nil },
+			want: map[string]status{"provider": statusFail},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGCP()
+			if tt.fake != nil {
+				tt.fake(f)
+			}
+			f.start(t)
+			claims := validClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			d := newDiagnosis(mintJWT(t, signingKey, testKID, claims))
+			d.localKey = &signingKey.PublicKey
+
+			d.readProvider(context.Background())
+			d.checkProvider()
+			wantStatuses(t, d, tt.want)
+		})
+	}
+}
+
+func TestCheckProviderAttributes(t *testing.T) {
+	f := newFakeGCP()
+	f.start(t)
+	d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+	d.readProvider(context.Background())
+	d.checkProvider()
+
+	want := map[string]string{"google.subject": "alice", "attribute.environment": "prod"}
+	for name, value := range want {
+		if d.attributes[name] != value {
+			t.Errorf("attribute %s = %q, want %q", name, d.attributes[name], value)
+		}
+	}
+}
+
+func TestCheckProviderErrors(t *testing.T) {
+	t.Run("not found", func(t *testing.T) {
+		f := newFakeGCP()
+		f.pool = nil
+		f.start(t)
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.readProvider(context.Background())
+		d.checkProvider()
+
+		c := wantCheck(t, d, "provider")
+		if !strings.Contains(c.Detail, "failed to read the pool") || !strings.Contains(c.Fix, "pool") {
+			t.Errorf("provider = %q, fix %q; want the pool-not-found hint", c.Detail, c.Fix)
+		}
+	})
+	t.Run("bad admin token", func(t *testing.T) {
+		newFakeGCP().start(t)
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.AdminToken = "expired-token"
+		d.readProvider(context.Background())
+		d.checkProvider()
+		wantStatuses(t, d, map[string]status{"provider": statusFail})
+	})
+	t.Run("no admin token", func(t *testing.T) {
+		d := newDiagnosis(mintJWT(t, signingKey, testKID, validClaims()))
+		d.AdminToken = ""
+		d.checkProvider()
+		wantStatuses(t, d, map[string]status{"provider": statusSkip})
+	})
+	t.Run("token doesn't decode", func(t *testing.T) {
+		newFakeGCP().start(t)
+		d := newDiagnosis("not-a-jwt")
+		d.readProvider(context.Background())
+		d.checkProvider()
+		wantStatuses(t, d, map[string]status{"provider": statusOK, "token": statusSkip})
+	})
+}
@@ -0,0 +1,162 @@
+package doctor
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxTokenLifetime is the longest exp - iat STS accepts.
+const maxTokenLifetime = 24 * time.Hour
+
+// decodeToken decodes the JWT without verifying it, so that every step can
+// use its header and claims.
+func (d *diagnosis) decodeToken(token string) {
+	d.token = token
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		d.tokenErr = err
+		return
+	}
+	d.header = parsed.Header
+	d.claims = claims
+}
+
+// kid returns the JWT's key ID header.
+func (d *diagnosis) kid() string {
+	kid, _ := d.header["kid"].(string)
+	return kid
+}
+
+// claim returns a string claim.
+func (d *diagnosis) claim(name string) string {
+	value, _ := d.claims[name].(string)
+	return value
+}
+
+// checkToken checks the JWT's signature and times.
+func (d *diagnosis) checkToken(now time.Time) {
+	if d.tokenErr != nil {
+		d.add("format", statusFail, fmt.Sprintf("not a JWT: %v", d.tokenErr), "Pass the JWT written by create-jwt (header.payload.signature)")
+		return
+	}
+	d.add("format", statusOK, fmt.Sprintf("JWT with kid %q", d.kid()), "")
+
+	if alg, _ := d.header["alg"].(string); alg != "RS256" {
+		d.add("algorithm", statusFail, fmt.Sprintf("alg is %q; the keys here are RSA and sign with RS256", alg), "Mint the JWT with create-jwt")
+	} else {
+		d.add("algorithm", statusOK, "RS256", "")
+	}
+
+	d.checkSignature()
+
+	for _, name := range []string{"iss", "sub", "aud"} {
+		if _, ok := d.claims[name]; !ok {
+			d.add(name, statusFail, fmt.Sprintf("the JWT has no %s claim", name), fmt.Sprintf("Mint the JWT with create-jwt, which sets %s", name))
+		}
+	}
+	if sub := d.claim("sub"); sub != "" {
+		d.add("subject", statusOK, fmt.Sprintf("sub is %q", sub), "")
+	}
+
+	d.checkTimes(now)
+}
+
+// checkSignature verifies the JWT with the key STS would use: the
+// provider's JWKS when it was read, otherwise the local JWKS or key.
+func (d *diagnosis) checkSignature() {
+	var (
+		key    *rsa.PublicKey
+		source string
+	)
+	switch {
+	case d.provider != nil && d.provider.OIDC != nil && d.provider.OIDC.JWKSJSON != "":
+		set, err := parseJWKS([]byte(d.provider.OIDC.JWKSJSON))
+		if err != nil {
+			d.add("signature", statusFail, fmt.Sprintf("the provider's JWKS is invalid: %v", err), "Upload the JWKS written by generate-jwk with update-oidc --jwk-json-path")
+			return
+		}
+		key, source = d.jwksKey(set), "the provider's JWKS"
+	case d.localJWKS != nil:
+		key, source = d.jwksKey(d.localJWKS), "the local JWKS"
+	case d.localKey != nil:
+		key, source = d.localKey, "the local key"
+	default:
+		d.add("signature", statusSkip, "no key to verify with",
+			"Pass --public-key or --jwks, or --admin-token-input to verify with the provider's JWKS")
+		return
+	}
+	if key == nil {
+		d.add("signature", statusFail, fmt.Sprintf("%s has no usable key with kid %q", source, d.kid()),
+			"Mint the JWT with create-jwt --key-id set to a key ID of the JWKS")
+		return
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	_, err := parser.Parse(d.token, func(*jwt.Token) (interface{}, error) { return key, nil })
+	switch {
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		d.add("signature", statusFail, fmt.Sprintf("the signature doesn't verify with %s", source),
+			"The JWT was signed with a different private key. Mint it with the key the JWKS was generated from,\n"+
+				"or regenerate the JWKS with generate-jwk and update the provider")
+	case err != nil:
+		d.add("signature", statusFail, err.Error(), "Mint the JWT with create-jwt")
+	default:
+		d.add("signature", statusOK, fmt.Sprintf("verified with %s", source), "")
+	}
+}
+
+// jwksKey returns the key of set the JWT names, or nil.
+func (d *diagnosis) jwksKey(set *jwks) *rsa.PublicKey {
+	k := set.find(d.kid())
+	if k == nil {
+		return nil
+	}
+	key, err := k.publicKey()
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// checkTimes checks iat, nbf and exp against the local clock, allowing
+// clockSkew.
+func (d *diagnosis) checkTimes(now time.Time) {
+	const fix = "Mint a new JWT with create-jwt and check that the local clock is correct"
+
+	issuedAt, _ := d.claims.GetIssuedAt()
+	expiresAt, _ := d.claims.GetExpirationTime()
+	notBefore, _ := d.claims.GetNotBefore()
+
+	switch {
+	case issuedAt == nil:
+		d.add("iat", statusFail, "the JWT has no iat claim", fix)
+	case issuedAt.After(now.Add(clockSkew)):
+		d.add("iat", statusFail, fmt.Sprintf("issued %s in the future", issuedAt.Sub(now).Round(time.Second)), fix)
+	default:
+		d.add("iat", statusOK, fmt.Sprintf("issued %s ago", now.Sub(issuedAt.Time).Round(time.Second)), "")
+	}
+
+	if notBefore != nil && notBefore.After(now.Add(clockSkew)) {
+		d.add("nbf", statusFail, fmt.Sprintf("not valid for another %s", notBefore.Sub(now).Round(time.Second)), fix)
+	}
+
+	switch {
+	case expiresAt == nil:
+		d.add("exp", statusFail, "the JWT has no exp claim", fix)
+		return
+	case !expiresAt.After(now):
+		d.add("exp", statusFail, fmt.Sprintf("expired %s ago", now.Sub(expiresAt.Time).Round(time.Second)), fix)
+	default:
+		d.add("exp", statusOK, fmt.Sprintf("expires in %s", expiresAt.Sub(now).Round(time.Second)), "")
+	}
+
+	if issuedAt != nil && expiresAt.Sub(issuedAt.Time) > maxTokenLifetime {
+		d.add("lifetime", statusFail, fmt.Sprintf("valid for %s; STS rejects tokens valid for more than 24 hours", expiresAt.Sub(issuedAt.Time)),
+			"Mint the JWT with an exp at most 24 hours after iat")
+	}
+}
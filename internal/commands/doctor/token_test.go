@@ -0,0 +1,161 @@
+package doctor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckToken(t *testing.T) {
+	now := time.Now()
+	with := func(changes jwt.MapClaims) jwt.MapClaims {
+		claims := validClaims()
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		want  map[string]status
+	}{
+		{
+			name:  "valid",
+			token: func(t *testing.T) string { return mintJWT(t, signingKey, testKID, validClaims()) },
+			want:  map[string]status{"format": statusOK, "algorithm": statusOK, "signature": statusOK, "subject": statusOK, "iat": statusOK, "exp": statusOK},
+		},
+		{
+			name:  "not a JWT",
+			token: func(t *testing.T) string { return "not-a-jwt" },
+			want:  map[string]status{"format": statusFail},
+		},
+		{
+			name:  "signed with another key",
+			token: func(t *testing.T) string { return mintJWT(t, otherKey, testKID, validClaims()) },
+			want:  map[string]status{"format": statusOK, "signature": statusFail, "exp": statusOK},
+		},
+		{
+			name: "HS256",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("secret"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			want: map[string]status{"algorithm": statusFail, "signature": statusFail},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return mintJWT(t, signingKey, testKID, with(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}))
+			},
+			want: map[string]status{"signature": statusOK, "exp": statusFail},
+		},
+		{
+			name: "issued in the future",
+			token: func(t *testing.T) string {
+				return mintJWT(t, signingKey, testKID, with(jwt.MapClaims{"iat": now.Add(time.Hour).Unix()}))
+			},
+			want: map[string]status{"iat": statusFail},
+		},
+		{
+			name: "not yet valid",
+			token: func(t *testing.T) string {
+				return mintJWT(t, signingKey, testKID, with(jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()}))
+			},
+			want: map[string]status{"nbf": statusFail, "exp": statusOK},
+		},
+		{
+			name: "valid for more than a day",
+			token: func(t *testing.T) string {
+				return mintJWT(t, signingKey, testKID, with(jwt.MapClaims{"exp": now.Add(48 * time.Hour).Unix()}))
+			},
+			want: map[string]status{"exp": statusOK, "lifetime": statusFail},
+		},
+		{
+			name: "missing claims",
+			token: func(t *testing.T) string {
+				return mintJWT(t, signingKey, testKID, with(jwt.MapClaims{"sub": nil, "iat": nil, "exp": nil}))
+			},
+			want: map[string]status{"sub": statusFail, "iat": statusFail, "exp": statusFail},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDiagnosis(tt.token(t))
+			d.localKey = &signingKey.PublicKey
+			d.checkToken(now)
+			wantStatuses(t, d, tt.want)
+		})
+	}
+}
+
+func TestCheckSignatureKeySource(t *testing.T) {
+	token := mintJWT(t, signingKey, testKID, validClaims())
+	tests := []struct {
+		name   string
+		setup  func(d *diagnosis)
+		want   status
+		source string
+	}{
+		{
+			name:  "no key",
+			setup: func(d *diagnosis) {},
+			want:  statusSkip,
+		},
+		{
+			name:   "local key",
+			setup:  func(d *diagnosis) { d.localKey = &signingKey.PublicKey },
+			want:   statusOK,
+			source: "the local key",
+		},
+		{
+			name: "local JWKS over the local key",
+			setup: func(d *diagnosis) {
+				d.localKey = &signingKey.PublicKey
+				d.localJWKS, _ = parseJWKS([]byte(jwksJSON(&otherKey.PublicKey, testKID)))
+			},
+			want:   statusFail,
+			source: "the local JWKS",
+		},
+		{
+			name: "provider's JWKS over the local ones",
+			setup: func(d *diagnosis) {
+				d.localJWKS, _ = parseJWKS([]byte(jwksJSON(&otherKey.PublicKey, testKID)))
+				d.provider = &provider{}
+				d.provider.OIDC = &struct {
+					IssuerURI        string   `json:"issuerUri"`
+					AllowedAudiences []string `json:"allowedAudiences"`
+					JWKSJSON         string   `json:"jwksJson"`
+				}{JWKSJSON: jwksJSON(&signingKey.PublicKey, testKID)}
+			},
+			want:   statusOK,
+			source: "the provider's JWKS",
+		},
+		{
+			name:   "JWKS without the kid",
+			setup:  func(d *diagnosis) { d.localJWKS, _ = parseJWKS([]byte(jwksJSON(&signingKey.PublicKey, "key-2"))) },
+			want:   statusFail,
+			source: "the local JWKS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDiagnosis(token)
+			tt.setup(d)
+			d.checkSignature()
+			c := wantCheck(t, d, "signature")
+			if c.Status != tt.want || !strings.Contains(c.Detail, tt.source) {
+				t.Errorf("signature = %s %q, want %s from %s", c.Status, c.Detail, tt.want, tt.source)
+			}
+		})
+	}
+}
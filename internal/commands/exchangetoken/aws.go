@@ -0,0 +1,319 @@
+package exchangetoken
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/sts"
+)
+
+const (
+	defaultIMDSURL            = "http://169.254.169.254"
+	defaultAWSVerificationURL = "https://sts.{region}.amazonaws.com?Action=GetCallerIdentity&Version=2011-06-15"
+	awsAlgorithm              = "AWS4-HMAC-SHA256"
+	awsTimeFormat             = "20060102T150405Z"
+	awsDateFormat             = "20060102"
+)
+
+// awsSource describes where to find the AWS region and credentials used to
+// sign the GetCallerIdentity request that GCP accepts as a subject token.
+type awsSource struct {
+	Region          string // overrides AWS_REGION and the IMDS lookup when set
+	IMDSURL         string // base URL of the instance metadata service
+	VerificationURL string // GetCallerIdentity URL, "{region}" is substituted
+	Audience        string // pool provider audience the request is bound to
+
+	// caller is whose credentials signed the last request, for the token
+	// cache: the instance's role ARN, or the access key ID from the
+	// environment.
+	caller string
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+type awsRequestHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type awsRequest struct {
+	URL     string             `json:"url"`
+	Method  string             `json:"method"`
+	Headers []awsRequestHeader `json:"headers"`
+}
+
+func (s *awsSource) TokenType() string {
+	return sts.TokenTypeAWS
+}
+
+func (s *awsSource) Caller() string {
+	return s.caller
+}
+
+// SubjectToken builds the serialized, SigV4-signed GetCallerIdentity
+// request that STS expects for the aws4_request subject token type.
+func (s *awsSource) SubjectToken() (string, error) {
+	fmt.Fprintln(cli.Log, "Building AWS GetCallerIdentity subject token...")
+	fmt.Fprintln(cli.Log)
+
+	imds := &imdsClient{baseURL: strings.TrimSuffix(s.IMDSURL, "/")}
+
+	region, err := awsRegion(s, imds)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine AWS region: %w", err)
+	}
+
+	creds, caller, err := awsCredentialsFromEnvOrIMDS(imds)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+	s.caller = caller
+
+	fmt.Fprintln(cli.Log, "  AWS details:")
+	fmt.Fprintf(cli.Log, "    Region: %s\n", region)
+	fmt.Fprintf(cli.Log, "    Access key ID: %s\n", creds.AccessKeyID)
+	fmt.Fprintln(cli.Log)
+
+	verificationURL := strings.ReplaceAll(s.VerificationURL, "{region}", region)
+	req, err := http.NewRequest("POST", verificationURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid verification URL: %w", err)
+	}
+	req.Header.Set("x-goog-cloud-target-resource", s.Audience)
+
+	if err := signAWSRequest(req, creds, region, "sts", time.Now().UTC()); err != nil {
+		return "", err
+	}
+
+	serialized := awsRequest{
+		URL:    verificationURL,
+		Method: req.Method,
+	}
+	for key, values := range req.Header {
+		serialized.Headers = append(serialized.Headers, awsRequestHeader{
+			Key:   key,
+			Value: strings.Join(values, ","),
+		})
+	}
+	sort.Slice(serialized.Headers, func(i, j int) bool {
+		return serialized.Headers[i].Key < serialized.Headers[j].Key
+	})
+
+	tokenJSON, err := json.Marshal(serialized)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal AWS request: %w", err)
+	}
+
+	return url.QueryEscape(string(tokenJSON)), nil
+}
+
+func awsRegion(src *awsSource, imds *imdsClient) (string, error) {
+	if src.Region != "" {
+		return src.Region, nil
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region, nil
+	}
+	if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+		return region, nil
+	}
+
+	zone, err := imds.get("/latest/meta-data/placement/availability-zone")
+	if err != nil {
+		return "", err
+	}
+	// The region is the availability zone without its trailing letter.
+	if len(zone) < 2 {
+		return "", fmt.Errorf("unexpected availability zone %q", zone)
+	}
+	return zone[:len(zone)-1], nil
+}
+
+// awsCredentialsFromEnvOrIMDS returns the credentials to sign with and the
+// identity they belong to: the access key ID for credentials from the
+// environment, and the role ARN for the instance's role.
+func awsCredentialsFromEnvOrIMDS(imds *imdsClient) (*awsCredentials, string, error) {
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID != "" && secretAccessKey != "" {
+		return &awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, "access-key " + accessKeyID, nil
+	}
+
+	roleName, err := imds.get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, "", err
+	}
+	roleName = strings.TrimSpace(strings.SplitN(roleName, "\n", 2)[0])
+	if roleName == "" {
+		return nil, "", fmt.Errorf("no IAM role attached to the instance")
+	}
+
+	credsJSON, err := imds.get("/latest/meta-data/iam/security-credentials/" + roleName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var creds awsCredentials
+	if err := json.Unmarshal([]byte(credsJSON), &creds); err != nil {
+		return nil, "", fmt.Errorf("failed to parse IMDS credentials: %w", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, "", fmt.Errorf("IMDS returned incomplete credentials for role %s", roleName)
+	}
+	return &creds, roleARN(imds, roleName), nil
+}
+
+// roleARN returns the ARN of the instance's role, built from the account
+// and partition of its instance profile. It falls back to "role/NAME",
+// which is as stable on one instance, when the profile can't be read.
+func roleARN(imds *imdsClient, roleName string) string {
+	fallback := "role/" + roleName
+	infoJSON, err := imds.get("/latest/meta-data/iam/info")
+	if err != nil {
+		return fallback
+	}
+	var info struct {
+		InstanceProfileArn string `json:"InstanceProfileArn"`
+	}
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fallback
+	}
+	// arn:aws:iam::123456789012:instance-profile/NAME
+	account, _, ok := strings.Cut(info.InstanceProfileArn, ":instance-profile/")
+	if !ok {
+		return fallback
+	}
+	return account + ":role/" + roleName
+}
+
+// imdsClient talks to an IMDSv2-style metadata endpoint, fetching a session
+// token on first use and sending it with every subsequent request.
+type imdsClient struct {
+	baseURL      string
+	sessionToken string
+}
+
+func (c *imdsClient) get(path string) (string, error) {
+	if c.sessionToken == "" {
+		header := http.Header{}
+		header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+
+		token, err := c.do("PUT", "/latest/api/token", header)
+		if err != nil {
+			return "", fmt.Errorf("failed to get IMDS session token: %w", err)
+		}
+		c.sessionToken = token
+	}
+
+	header := http.Header{}
+	header.Set("X-aws-ec2-metadata-token", c.sessionToken)
+	return c.do("GET", path, header)
+}
+
+func (c *imdsClient) do(method, path string, header http.Header) (string, error) {
+	resp, err := httpClient.Do(context.Background(), method, c.baseURL+path, header, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IMDS error (status %d) for %s: %s", resp.StatusCode, path, string(resp.Body))
+	}
+
+	return string(resp.Body), nil
+}
+
+// signAWSRequest adds SigV4 headers (x-amz-date, x-amz-security-token and
+// Authorization) to a request with an empty body.
+func signAWSRequest(req *http.Request, creds *awsCredentials, region, service string, now time.Time) error {
+	amzDate := now.Format(awsTimeFormat)
+	date := now.Format(awsDateFormat)
+
+	req.Header.Set("host", req.URL.Host)
+	req.Header.Set("x-amz-date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("x-amz-security-token", creds.Token)
+	}
+
+	var headerNames []string
+	canonicalHeaders := map[string]string{}
+	for key, values := range req.Header {
+		name := strings.ToLower(key)
+		headerNames = append(headerNames, name)
+		canonicalHeaders[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(headerNames)
+
+	var headerBlock bytes.Buffer
+	for _, name := range headerNames {
+		fmt.Fprintf(&headerBlock, "%s:%s\n", name, canonicalHeaders[name])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+	payloadHash := sha256.Sum256(nil)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		canonicalQuery(req.URL.Query()),
+		headerBlock.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		awsAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+	return nil
+}
+
+func canonicalQuery(values url.Values) string {
+	// url.Values.Encode sorts by key; SigV4 additionally wants %20 for spaces.
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,209 @@
+package exchangetoken
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The credentials and date of the AWS SigV4 test suite.
+var (
+	suiteCredentials = &awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	suiteTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{
+			name:   "get-vanilla",
+			method: "GET",
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: "GET",
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "post-vanilla",
+			method: "POST",
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := signAWSRequest(req, suiteCredentials, "us-east-1", "service", suiteTime); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization =\n  %s\nwant\n  %s", got, tt.want)
+			}
+			if got := req.Header.Get("x-amz-date"); got != "20150830T123600Z" {
+				t.Errorf("x-amz-date = %q", got)
+			}
+		})
+	}
+}
+
+func TestSignAWSRequestSessionToken(t *testing.T) {
+	creds := *suiteCredentials
+	creds.Token = "session-token"
+	req, err := http.NewRequest("POST", "https://sts.us-east-1.amazonaws.com?Action=GetCallerIdentity&Version=2011-06-15", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("x-goog-cloud-target-resource", "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/aws")
+	if err := signAWSRequest(req, &creds, "us-east-1", "sts", suiteTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := req.Header.Get("x-amz-security-token"); got != "session-token" {
+		t.Errorf("x-amz-security-token = %q, want the session token", got)
+	}
+	const wantSigned = "SignedHeaders=host;x-amz-date;x-amz-security-token;x-goog-cloud-target-resource,"
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, wantSigned) || !strings.Contains(got, "/20150830/us-east-1/sts/aws4_request") {
+		t.Errorf("Authorization = %q, want it to sign the token and audience headers for sts", got)
+	}
+}
+
+// fakeIMDS is an IMDSv2 server for one instance with the role ci-role.
+type fakeIMDS struct {
+	tokenRequests int
+	requests      []string
+}
+
+func (f *fakeIMDS) start(t *testing.T) string {
+	t.Helper()
+	const sessionToken = "imds-session"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				http.Error(w, "missing TTL", http.StatusBadRequest)
+				return
+			}
+			f.tokenRequests++
+			w.Write([]byte(sessionToken))
+			return
+		}
+		if r.Method != http.MethodGet || r.Header.Get("X-aws-ec2-metadata-token") != sessionToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("eu-west-1b"))
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("ci-role\n"))
+		case "/latest/meta-data/iam/security-credentials/ci-role":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","Token":"role-session","Expiration":"2030-01-01T00:00:00Z"}`))
+		case "/latest/meta-data/iam/info":
+			w.Write([]byte(`{"Code":"Success","InstanceProfileArn":"arn:aws:iam::123456789012:instance-profile/ci-profile"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	useTestHTTPClient(t)
+	return server.URL
+}
+
+func TestAWSSourceIMDS(t *testing.T) {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	imds := &fakeIMDS{}
+	src := &awsSource{
+		IMDSURL:         imds.start(t),
+		VerificationURL: defaultAWSVerificationURL,
+		Audience:        "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/aws",
+	}
+
+	token, err := src.SubjectToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imds.tokenRequests != 1 {
+		t.Errorf("got %d session token requests, want 1 shared by every GET:\n%s", imds.tokenRequests, strings.Join(imds.requests, "\n"))
+	}
+	if got, want := src.Caller(), "arn:aws:iam::123456789012:role/ci-role"; got != want {
+		t.Errorf("Caller() = %q, want %q", got, want)
+	}
+
+	tokenJSON, err := url.QueryUnescape(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req awsRequest
+	if err := json.Unmarshal([]byte(tokenJSON), &req); err != nil {
+		t.Fatalf("subject token isn't a serialized request: %v", err)
+	}
+	if req.Method != "POST" || req.URL != "https://sts.eu-west-1.amazonaws.com?Action=GetCallerIdentity&Version=2011-06-15" {
+		t.Errorf("request = %s %s, want a POST to the eu-west-1 STS endpoint", req.Method, req.URL)
+	}
+	headers := map[string]string{}
+	for _, h := range req.Headers {
+		headers[strings.ToLower(h.Key)] = h.Value
+	}
+	if headers["x-amz-security-token"] != "role-session" {
+		t.Errorf("x-amz-security-token = %q, want the role's session token", headers["x-amz-security-token"])
+	}
+	if headers["x-goog-cloud-target-resource"] != src.Audience {
+		t.Errorf("x-goog-cloud-target-resource = %q, want %q", headers["x-goog-cloud-target-resource"], src.Audience)
+	}
+	if !strings.HasPrefix(headers["authorization"], "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") {
+		t.Errorf("Authorization = %q, want it signed with the role's credentials", headers["authorization"])
+	}
+}
+
+func TestAWSSourceEnvironment(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-2")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	imds := &fakeIMDS{}
+	src := &awsSource{IMDSURL: imds.start(t), VerificationURL: defaultAWSVerificationURL}
+
+	if _, err := src.SubjectToken(); err != nil {
+		t.Fatal(err)
+	}
+	if len(imds.requests) > 0 {
+		t.Errorf("IMDS was called although the environment has credentials:\n%s", strings.Join(imds.requests, "\n"))
+	}
+	if got, want := src.Caller(), "access-key AKIAEXAMPLE"; got != want {
+		t.Errorf("Caller() = %q, want %q", got, want)
+	}
+}
+
+func TestIMDSErrors(t *testing.T) {
+	imds := &fakeIMDS{}
+	client := &imdsClient{baseURL: imds.start(t)}
+	if _, err := client.get("/latest/meta-data/iam/security-credentials/other-role"); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("get() error = %v, want the IMDS status", err)
+	}
+
+	// A session token the server doesn't know is rejected.
+	client = &imdsClient{baseURL: client.baseURL, sessionToken: "stale"}
+	if _, err := client.get("/latest/meta-data/placement/availability-zone"); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("get() with a stale session token error = %v, want status 401", err)
+	}
+}
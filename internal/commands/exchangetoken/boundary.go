@@ -0,0 +1,120 @@
+package exchangetoken
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/sts"
+)
+
+const (
+	// maxBoundaryRules is the most rules STS accepts in one boundary.
+	maxBoundaryRules = 10
+)
+
+// accessBoundary is the Credential Access Boundary sent to STS in the
+// options parameter of a downscoping exchange.
+type accessBoundary struct {
+	AccessBoundary struct {
+		AccessBoundaryRules []accessBoundaryRule `json:"accessBoundaryRules"`
+	} `json:"accessBoundary"`
+}
+
+type accessBoundaryRule struct {
+	AvailableResource     string                 `json:"availableResource"`
+	AvailablePermissions  []string               `json:"availablePermissions"`
+	AvailabilityCondition *availabilityCondition `json:"availabilityCondition,omitempty"`
+}
+
+type availabilityCondition struct {
+	Expression string `json:"expression"`
+}
+
+// boundaryRules collects the --boundary-* flags. Each --boundary-resource
+// starts a rule; --boundary-role and --boundary-condition apply to the rule
+// started last.
+type boundaryRules []accessBoundaryRule
+
+func (b *boundaryRules) registerFlags(fs *flag.FlagSet) {
+	fs.Func("boundary-resource", "Start a Credential Access Boundary rule for this resource, e.g. //storage.googleapis.com/projects/_/buckets/BUCKET (repeatable)", func(resource string) error {
+		*b = append(*b, accessBoundaryRule{AvailableResource: resource})
+		return nil
+	})
+	fs.Func("boundary-role", "Role available on the current --boundary-resource, e.g. roles/storage.objectViewer (repeatable)", func(role string) error {
+		rule, err := b.current("--boundary-role")
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(role, "inRole:") {
+			role = "inRole:" + role
+		}
+		rule.AvailablePermissions = append(rule.AvailablePermissions, role)
+		return nil
+	})
+	fs.Func("boundary-condition", "CEL condition restricting the current --boundary-resource", func(expression string) error {
+		rule, err := b.current("--boundary-condition")
+		if err != nil {
+			return err
+		}
+		rule.AvailabilityCondition = &availabilityCondition{Expression: expression}
+		return nil
+	})
+}
+
+func (b *boundaryRules) current(flagName string) (*accessBoundaryRule, error) {
+	if len(*b) == 0 {
+		return nil, fmt.Errorf("%s must follow a --boundary-resource", flagName)
+	}
+	return &(*b)[len(*b)-1], nil
+}
+
+// boundary returns the access boundary built from the rules, or nil when no
+// rules were given.
+func (b boundaryRules) boundary() (*accessBoundary, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) > maxBoundaryRules {
+		return nil, fmt.Errorf("at most %d boundary rules are allowed, got %d", maxBoundaryRules, len(b))
+	}
+	for _, rule := range b {
+		if len(rule.AvailablePermissions) == 0 {
+			return nil, fmt.Errorf("boundary rule for %s has no --boundary-role", rule.AvailableResource)
+		}
+	}
+
+	var ab accessBoundary
+	ab.AccessBoundary.AccessBoundaryRules = b
+	return &ab, nil
+}
+
+// downscopeToken exchanges an access token for one restricted to the
+// boundary. The new token cannot be used beyond the source token's lifetime.
+func downscopeToken(accessToken string, boundary *accessBoundary) (*sts.TokenResponse, error) {
+	client := &sts.Client{HTTP: httpClient, BaseURL: netConfig.ServiceURL("sts")}
+
+	boundaryJSON, err := json.Marshal(boundary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal access boundary: %w", err)
+	}
+
+	requestBody := map[string]string{
+		"subject_token_type": sts.TokenTypeAccessToken,
+		"subject_token":      accessToken,
+		"options":            string(boundaryJSON),
+	}
+
+	fmt.Fprintln(cli.Log, "  Request details:")
+	fmt.Fprintf(cli.Log, "    Endpoint: %s\n", client.TokenURL())
+	fmt.Fprintf(cli.Log, "    Grant type: token-exchange\n")
+	fmt.Fprintf(cli.Log, "    Subject token type: %s\n", sts.TokenTypeAccessToken)
+	indented, _ := json.MarshalIndent(boundary, "    ", "  ")
+	fmt.Fprintf(cli.Log, "    Access boundary: %s\n", indented)
+	fmt.Fprintln(cli.Log)
+
+	return client.Exchange(context.Background(), requestBody)
+}
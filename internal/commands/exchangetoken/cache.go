@@ -0,0 +1,181 @@
+package exchangetoken
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/sts"
+	"wif-poc/internal/tokencache"
+)
+
+// cachedExchange returns the cached token for the subject when it's still
+// fresh, and otherwise runs the exchanges and caches the result. The cache
+// entry stays locked meanwhile, so parallel runs for the same identity wait
+// for one refresh instead of each calling STS and IAM. cached reports
+// whether the token came from the cache.
+func cachedExchange(src subjectTokenSource, subjectToken, subjectTokenType string, p exchangeParams) (lifetime time.Duration, cached bool, err error) {
+	subject := subjectIdentity(src, subjectToken, subjectTokenType)
+	if subject == "" {
+		fmt.Fprintln(cli.Log, "The subject token names no identity to cache it under; not using the cache")
+		fmt.Fprintln(cli.Log)
+		_, lifetime, err = exchangeSubjectToken(subjectToken, subjectTokenType, p)
+		return lifetime, false, err
+	}
+	key := cacheKey(subject, p)
+
+	unlock, err := p.Cache.Lock(key)
+	if err != nil {
+		return 0, false, err
+	}
+	defer unlock()
+
+	// A cached token must not outlive the subject token it was issued for;
+	// once that has expired, STS decides.
+	expired := subjectTokenExpired(subjectToken, subjectTokenType)
+	if expired {
+		fmt.Fprintln(cli.Log, "Subject token has expired; not using the cache")
+		fmt.Fprintln(cli.Log)
+	}
+
+	if entry, ok := p.Cache.Get(key, p.CacheMargin); ok && !expired {
+		lifetime = time.Until(entry.ExpiresAt)
+
+		fmt.Fprintln(cli.Log, "✓ Using cached token, no STS or IAM call needed")
+		fmt.Fprintf(cli.Log, "  Subject: %s\n", key.Subject)
+		fmt.Fprintf(cli.Log, "  Expires at: %s (in %s)\n", entry.ExpiresAt.Format(time.RFC3339), lifetime.Round(time.Second))
+		fmt.Fprintln(cli.Log)
+
+		if err := cli.WriteFile(p.OutputPath, []byte(entry.Token)); err != nil {
+			return 0, false, fmt.Errorf("failed to write token: %w", err)
+		}
+		fmt.Fprintf(cli.Log, "Token saved to: %s\n", cli.OutputName(p.OutputPath))
+		return lifetime, true, nil
+	}
+
+	token, lifetime, err := exchangeSubjectToken(subjectToken, subjectTokenType, p)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if expired {
+		return lifetime, false, nil
+	}
+	if err := p.Cache.Put(key, token, time.Now().Add(lifetime)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache token: %v\n", err)
+	} else {
+		fmt.Fprintf(cli.Log, "Token cached in: %s\n", p.Cache.Dir)
+	}
+	return lifetime, false, nil
+}
+
+// cacheKey identifies the token an exchange for subject would produce.
+func cacheKey(subject string, p exchangeParams) tokencache.Key {
+	key := tokencache.Key{
+		Audience:       p.Audience,
+		ServiceAccount: p.ServiceAccount,
+		Scopes:         []string{sts.CloudPlatformScope},
+		Subject:        subject,
+	}
+	switch {
+	case p.IDTokenAudience != "":
+		key.Scopes = nil
+		key.Variant = fmt.Sprintf("id_token audience=%s include_email=%t", p.IDTokenAudience, p.IncludeEmail)
+	case p.Boundary != nil:
+		boundaryJSON, _ := json.Marshal(p.Boundary)
+		key.Variant = "boundary " + string(boundaryJSON)
+	}
+	return key
+}
+
+// subjectIdentity names who the subject token stands for, so that every
+// token of one identity shares a cache entry even though create-jwt mints a
+// new one each run: the issuer and subject of a JWT or SAML assertion, and
+// the caller of an AWS request. It returns "" when the token names nobody.
+func subjectIdentity(src subjectTokenSource, subjectToken, subjectTokenType string) string {
+	if c, ok := src.(callerSource); ok {
+		if caller := c.Caller(); caller != "" {
+			return "aws " + caller
+		}
+		return ""
+	}
+	switch subjectTokenType {
+	case sts.TokenTypeJWT:
+		claims, err := decodeJWTClaims(subjectToken)
+		if err != nil {
+			return ""
+		}
+		iss, _ := claims["iss"].(string)
+		sub, _ := claims["sub"].(string)
+		if sub == "" {
+			return ""
+		}
+		return fmt.Sprintf("jwt iss=%s sub=%s", iss, sub)
+	case sts.TokenTypeSAML2:
+		issuer, nameID := samlIdentity(subjectToken)
+		if nameID == "" {
+			return ""
+		}
+		return fmt.Sprintf("saml issuer=%s name_id=%s", issuer, nameID)
+	}
+	return ""
+}
+
+// samlIdentity returns the first Issuer and NameID of a base64-encoded SAML
+// assertion or response, without verifying it.
+func samlIdentity(subjectToken string) (issuer, nameID string) {
+	data, err := base64.StdEncoding.DecodeString(subjectToken)
+	if err != nil {
+		return "", ""
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for issuer == "" || nameID == "" {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || (start.Name.Local != "Issuer" && start.Name.Local != "NameID") {
+			continue
+		}
+		var text string
+		if err := decoder.DecodeElement(&text, &start); err != nil {
+			break
+		}
+		switch {
+		case start.Name.Local == "Issuer" && issuer == "":
+			issuer = strings.TrimSpace(text)
+		case start.Name.Local == "NameID" && nameID == "":
+			nameID = strings.TrimSpace(text)
+		}
+	}
+	return issuer, nameID
+}
+
+// subjectTokenExpired reports whether a JWT subject token's exp has passed.
+func subjectTokenExpired(subjectToken, subjectTokenType string) bool {
+	if subjectTokenType != sts.TokenTypeJWT {
+		return false
+	}
+	exp, ok := jwtExpiry(subjectToken)
+	return ok && !time.Now().Before(exp)
+}
+
+// jwtExpiry returns a JWT's exp claim, without verifying the token.
+func jwtExpiry(token string) (time.Time, bool) {
+	claims, err := decodeJWTClaims(token)
+	if err != nil {
+		return time.Time{}, false
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
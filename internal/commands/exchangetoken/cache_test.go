@@ -0,0 +1,105 @@
+package exchangetoken
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"wif-poc/internal/sts"
+)
+
+// unsignedJWT returns a JWT with the given claims and a dummy signature;
+// the cache never verifies one.
+func unsignedJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+}
+
+type fakeCallerSource struct{ caller string }
+
+func (s fakeCallerSource) SubjectToken() (string, error) { return "signed-request", nil }
+func (s fakeCallerSource) TokenType() string             { return sts.TokenTypeAWS }
+func (s fakeCallerSource) Caller() string                { return s.caller }
+
+func TestSubjectIdentity(t *testing.T) {
+	saml := base64.StdEncoding.EncodeToString([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Issuer> https://idp.example.com </saml:Issuer>
+  <saml:Assertion><saml:Issuer>https://idp.example.com</saml:Issuer><saml:Subject><saml:NameID>alice@example.com</saml:NameID></saml:Subject></saml:Assertion>
+</samlp:Response>`))
+	tests := []struct {
+		name      string
+		src       subjectTokenSource
+		token     string
+		tokenType string
+		want      string
+	}{
+		{
+			name:      "JWT",
+			token:     unsignedJWT(t, map[string]interface{}{"iss": "https://issuer.example.com", "sub": "alice", "exp": 1}),
+			tokenType: sts.TokenTypeJWT,
+			want:      "jwt iss=https://issuer.example.com sub=alice",
+		},
+		{
+			name:      "JWT without sub",
+			token:     unsignedJWT(t, map[string]interface{}{"iss": "https://issuer.example.com"}),
+			tokenType: sts.TokenTypeJWT,
+		},
+		{
+			name:      "not a JWT",
+			token:     "opaque",
+			tokenType: sts.TokenTypeJWT,
+		},
+		{
+			name:      "SAML",
+			token:     saml,
+			tokenType: sts.TokenTypeSAML2,
+			want:      "saml issuer=https://idp.example.com name_id=alice@example.com",
+		},
+		{
+			name:      "SAML without NameID",
+			token:     base64.StdEncoding.EncodeToString([]byte(`<Response><Issuer>https://idp.example.com</Issuer></Response>`)),
+			tokenType: sts.TokenTypeSAML2,
+		},
+		{
+			name:      "AWS",
+			src:       fakeCallerSource{caller: "arn:aws:iam::123456789012:role/ci"},
+			tokenType: sts.TokenTypeAWS,
+			want:      "aws arn:aws:iam::123456789012:role/ci",
+		},
+		{
+			name:      "AWS caller unknown",
+			src:       fakeCallerSource{},
+			tokenType: sts.TokenTypeAWS,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subjectIdentity(tt.src, tt.token, tt.tokenType); got != tt.want {
+				t.Errorf("subjectIdentity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKeySharedAcrossTokens(t *testing.T) {
+	p := exchangeParams{Audience: "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/p"}
+	first := unsignedJWT(t, map[string]interface{}{"iss": "https://issuer.example.com", "sub": "alice", "iat": 1, "exp": 3601})
+	second := unsignedJWT(t, map[string]interface{}{"iss": "https://issuer.example.com", "sub": "alice", "iat": 2, "exp": 3602})
+	other := unsignedJWT(t, map[string]interface{}{"iss": "https://issuer.example.com", "sub": "bob", "iat": 1, "exp": 3601})
+
+	key := func(token string) interface{} {
+		return cacheKey(subjectIdentity(nil, token, sts.TokenTypeJWT), p)
+	}
+	if !reflect.DeepEqual(key(first), key(second)) {
+		t.Errorf("two tokens for alice have different keys: %+v and %+v", key(first), key(second))
+	}
+	if reflect.DeepEqual(key(first), key(other)) {
+		t.Errorf("alice and bob share the key %+v", key(first))
+	}
+}
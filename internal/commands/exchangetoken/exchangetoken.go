@@ -0,0 +1,476 @@
+// Package exchangetoken implements "wif token exchange" (exchange-token).
+package exchangetoken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/iamcredentials"
+	"wif-poc/internal/output"
+	"wif-poc/internal/sts"
+	"wif-poc/internal/tokencache"
+)
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+// Command exchanges an external credential for a GCP access token.
+var Command = &cli.Command{
+	Name:    "token exchange",
+	Binary:  "exchange-token",
+	Summary: "Exchange an external JWT, SAML assertion or cloud credential for a GCP access token",
+	Synopsis: []string{
+		"--project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --token-input <PATH> --output <PATH>",
+		"--source url --token-url <URL> [--token-url-header \"Name: value\"] [--token-url-field <PATH>] --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --output <PATH>",
+		"--source aws --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --output <PATH>",
+		"--source k8s --k8s-token-path <PATH> --watch --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --output <PATH>",
+		"--source github --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --output <PATH>",
+		"--pool-type workforce --user-project <PROJECT> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> [--service-account <SERVICE_ACCOUNT_EMAIL>] --token-input <PATH> --output <PATH>",
+	},
+	Examples: []string{
+		"--project-number 123456789 --pool-id my-pool --provider-id my-provider --service-account my-sa@my-project.iam.gserviceaccount.com --token-input external_token.jwt --output gcp_access_token.txt",
+	},
+	Setup: setup,
+}
+
+func setup(fs *flag.FlagSet) func() {
+	projectNumber := fs.String("project-number", "", "GCP project number, not the project ID (required for workload pools)")
+	poolID := fs.String("pool-id", "", "Workload or Workforce Identity Pool ID (required)")
+	providerID := fs.String("provider-id", "", "Identity Provider ID (required)")
+	serviceAccount := fs.String("service-account", "", "Service account email to impersonate (required for workload pools, optional for workforce pools)")
+	poolType := fs.String("pool-type", "workload", "Identity pool type: workload or workforce")
+	userProject := fs.String("user-project", "", "Project number or ID billed for workforce pool requests (required for workforce pools)")
+	tokenPath := fs.String("token-input", "", "Path to the external JWT or SAML assertion file, - for stdin (required for --source file)")
+	outputPath := fs.String("output", "", "Path to save the GCP access token, - for stdout (required)")
+	source := fs.String("source", "file", "Subject token source: file, url, aws, k8s or github")
+	tokenType := fs.String("subject-token-type", "jwt", "Type of the --token-input file or --token-url response: jwt or saml2")
+	tokenURL := fs.String("token-url", "", "URL returning the subject token (required for --source url)")
+	tokenURLField := fs.String("token-url-field", "", "Dot-separated JSON field holding the token in the --token-url response, e.g. data.id_token (plain text when empty)")
+	var tokenURLHeaders cli.Headers
+	fs.Var(&tokenURLHeaders, "token-url-header", "Header sent to --token-url as \"Name: value\" (repeatable)")
+	awsRegion := fs.String("aws-region", "", "AWS region (defaults to AWS_REGION, AWS_DEFAULT_REGION or the instance metadata)")
+	awsIMDSURL := fs.String("aws-imds-url", defaultIMDSURL, "Base URL of the AWS instance metadata service")
+	awsVerificationURL := fs.String("aws-verification-url", defaultAWSVerificationURL, "AWS GetCallerIdentity URL presented to GCP, {region} is substituted")
+	k8sTokenPath := fs.String("k8s-token-path", defaultK8sTokenPath, "Path to the projected Kubernetes service account token")
+	githubAudience := fs.String("github-audience", "", "Audience requested from GitHub Actions (defaults to https: + the provider audience)")
+	idTokenAudience := fs.String("id-token-audience", "", "Mint a Google-signed ID token for this audience (e.g. a Cloud Run URL) instead of an access token")
+	includeEmail := fs.Bool("include-email", false, "Include the email and email_verified claims in the ID token")
+	watch := fs.Bool("watch", false, "Keep running and refresh the access token before it expires or when the subject token rotates")
+	refreshMargin := fs.Duration("refresh-margin", 5*time.Minute, "How long before expiry --watch and --cache refresh the token")
+	useCache := fs.Bool("cache", false, "Reuse a cached token for the same identity until --refresh-margin before it expires")
+	cacheDir := fs.String("cache-dir", tokencache.DefaultDir(), "Token cache directory (with --cache)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout, once per refresh with --watch (drops the tutorial text)")
+	var boundaryFlags boundaryRules
+	boundaryFlags.registerFlags(fs)
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		missingTokenInput := (*source == "file" && *tokenPath == "") || (*source == "url" && *tokenURL == "")
+		missingPoolParams := *projectNumber == "" || *serviceAccount == ""
+		if *poolType == "workforce" {
+			missingPoolParams = *userProject == ""
+		}
+		if (*idTokenAudience != "" || len(boundaryFlags) > 0) && *serviceAccount == "" {
+			missingPoolParams = true
+		}
+		if missingPoolParams || *poolID == "" || *providerID == "" || missingTokenInput || *outputPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+		if *printFormat != "" && *outputPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --print and --output - both write to stdout; save the token to a file to use --print")
+			os.Exit(1)
+		}
+		if *watch && *source == "file" && *tokenPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --watch re-reads --token-input on every refresh, so it can't be -")
+			os.Exit(1)
+		}
+		if *watch && *outputPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --watch rewrites --output on every refresh, so it can't be -; save the token to a file")
+			os.Exit(1)
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		boundary, err := boundaryFlags.boundary()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if boundary != nil && *idTokenAudience != "" {
+			fmt.Fprintln(os.Stderr, "Error: --boundary-resource applies to access tokens and can't be combined with --id-token-audience")
+			os.Exit(1)
+		}
+
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(cli.Log, format, args...) }
+
+		fmt.Fprintln(cli.Log, "=== Step 3: Exchanging JWT for GCP Access Token ===")
+		fmt.Fprintln(cli.Log, "This uses GCP's Security Token Service (STS) API")
+		fmt.Fprintln(cli.Log)
+
+		var audience string
+		var options map[string]string
+		switch *poolType {
+		case "workload":
+			audience = sts.WorkloadAudience(*projectNumber, *poolID, *providerID)
+		case "workforce":
+			audience = sts.WorkforceAudience(*poolID, *providerID)
+			// Workforce pools are not tied to a project, so STS needs to be
+			// told which project to bill.
+			options = map[string]string{"userProject": *userProject}
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown --pool-type %q (expected workload or workforce)\n", *poolType)
+			os.Exit(1)
+		}
+
+		var credentialTokenType string
+		switch *tokenType {
+		case "jwt":
+			credentialTokenType = sts.TokenTypeJWT
+		case "saml2":
+			credentialTokenType = sts.TokenTypeSAML2
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown --subject-token-type %q (expected jwt or saml2)\n", *tokenType)
+			os.Exit(1)
+		}
+
+		var src subjectTokenSource
+		switch *source {
+		case "file":
+			src = &fileSource{Path: *tokenPath, Type: credentialTokenType}
+		case "url":
+			src = &urlSource{
+				URL:       *tokenURL,
+				Headers:   tokenURLHeaders,
+				FieldPath: *tokenURLField,
+				Type:      credentialTokenType,
+			}
+		case "aws":
+			src = &awsSource{
+				Region:          *awsRegion,
+				IMDSURL:         *awsIMDSURL,
+				VerificationURL: *awsVerificationURL,
+				Audience:        audience,
+			}
+		case "k8s":
+			src = &k8sSource{Path: *k8sTokenPath}
+		case "github":
+			// Providers created without --allowed-audiences accept the
+			// provider's full resource URL as the token audience.
+			tokenAudience := *githubAudience
+			if tokenAudience == "" {
+				tokenAudience = "https:" + audience
+			}
+			src = &githubSource{Audience: tokenAudience}
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown --source %q (expected file, url, aws, k8s or github)\n", *source)
+			os.Exit(1)
+		}
+
+		params := exchangeParams{
+			Audience:       audience,
+			Options:        options,
+			PoolPath:       poolResourcePath(*poolType, *projectNumber, *poolID),
+			ServiceAccount: *serviceAccount,
+			OutputPath:     *outputPath,
+
+			IDTokenAudience: *idTokenAudience,
+			IncludeEmail:    *includeEmail,
+			Boundary:        boundary,
+			CacheMargin:     *refreshMargin,
+			Print:           *printFormat,
+		}
+		if *useCache {
+			params.Cache, err = tokencache.Open(*cacheDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening token cache: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if *watch {
+			watchAndRefresh(src, params, *refreshMargin)
+			return
+		}
+
+		if _, err := runExchange(src, params); err != nil {
+			cli.PrintError(os.Stderr, err)
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintln(os.Stderr, "Make sure to run create-jwt first!")
+			}
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		if *idTokenAudience != "" {
+			fmt.Fprintln(cli.Log, "Call the Cloud Run or IAP-protected service with the ID token:")
+			fmt.Fprintln(cli.Log)
+			fmt.Fprintf(cli.Log, "  curl -H \"Authorization: Bearer $(cat %s)\" %s\n", *outputPath, *idTokenAudience)
+			return
+		}
+		if boundary != nil {
+			fmt.Fprintln(cli.Log, "Hand the downscoped token to the less-trusted process; it only works within the boundary, e.g.:")
+			fmt.Fprintln(cli.Log)
+			fmt.Fprintf(cli.Log, "  curl -H \"Authorization: Bearer $(cat %s)\" https://storage.googleapis.com/storage/v1/b/BUCKET/o\n", *outputPath)
+			return
+		}
+		fmt.Fprintln(cli.Log, "Use the access token to call GCP APIs:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/list-topics --project-id <PROJECT_ID>")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Example:")
+		fmt.Fprintln(cli.Log, "  ./bin/list-topics --project-id my-project")
+	}
+}
+
+// exchangeParams holds everything the two-step exchange needs besides the
+// subject token itself.
+type exchangeParams struct {
+	Audience       string
+	Options        map[string]string
+	PoolPath       string
+	ServiceAccount string
+	OutputPath     string
+
+	// IDTokenAudience switches the second step from generateAccessToken to
+	// generateIdToken.
+	IDTokenAudience string
+	IncludeEmail    bool
+
+	// Boundary, when set, downscopes the access token in a third exchange.
+	Boundary *accessBoundary
+
+	// Cache, when set, is consulted before and updated after the
+	// exchanges. Cached tokens expiring within CacheMargin are refreshed.
+	Cache       *tokencache.Cache
+	CacheMargin time.Duration
+
+	// Print, when set, is the --print format of the result document
+	// written to stdout after each exchange.
+	Print string
+}
+
+// exchangeResult is the --print document of an exchange.
+type exchangeResult struct {
+	Path             string    `json:"path"`
+	TokenType        string    `json:"tokenType"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	ExpiresInSeconds int64     `json:"expiresInSeconds"`
+	Audience         string    `json:"audience"`
+	ServiceAccount   string    `json:"serviceAccount,omitempty"`
+	Subject          string    `json:"subject,omitempty"`
+	Cached           bool      `json:"cached"`
+}
+
+// tokenKind names the token the exchanges produce with p.
+func tokenKind(p exchangeParams) string {
+	switch {
+	case p.IDTokenAudience != "":
+		return "id_token"
+	case p.ServiceAccount == "":
+		return "federated_access_token"
+	case p.Boundary != nil:
+		return "downscoped_access_token"
+	}
+	return "access_token"
+}
+
+// runExchange performs the STS exchange (and service account impersonation
+// when configured), saves the resulting token and returns its lifetime.
+func runExchange(src subjectTokenSource, p exchangeParams) (time.Duration, error) {
+	subjectToken, err := src.SubjectToken()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get subject token: %w", err)
+	}
+	subjectTokenType := src.TokenType()
+
+	var lifetime time.Duration
+	cached := false
+	if p.Cache != nil {
+		lifetime, cached, err = cachedExchange(src, subjectToken, subjectTokenType, p)
+	} else {
+		_, lifetime, err = exchangeSubjectToken(subjectToken, subjectTokenType, p)
+	}
+	if err != nil || p.Print == "" {
+		return lifetime, err
+	}
+
+	result := exchangeResult{
+		Path:             p.OutputPath,
+		TokenType:        tokenKind(p),
+		ExpiresAt:        time.Now().Add(lifetime).UTC().Truncate(time.Second),
+		ExpiresInSeconds: int64(lifetime.Seconds()),
+		Audience:         p.Audience,
+		ServiceAccount:   p.ServiceAccount,
+		Subject:          jwtSubject(subjectToken, subjectTokenType),
+		Cached:           cached,
+	}
+	if err := output.Document(os.Stdout, p.Print, result); err != nil {
+		return lifetime, fmt.Errorf("failed to write output: %w", err)
+	}
+	return lifetime, nil
+}
+
+// exchangeSubjectToken runs the exchanges for a subject token, saves the
+// resulting token and returns it with its lifetime.
+func exchangeSubjectToken(subjectToken, subjectTokenType string, p exchangeParams) (string, time.Duration, error) {
+	fmt.Fprintln(cli.Log, "Step 3a: Exchange external token for federated token")
+	fmt.Fprintln(cli.Log, "Calling GCP STS token endpoint...")
+	fmt.Fprintln(cli.Log)
+
+	// Step 3a: Exchange external token for federated token
+	federatedToken, err := exchangeForFederatedToken(subjectToken, subjectTokenType, p.Audience, p.Options)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to exchange for federated token: %w", err)
+	}
+
+	fmt.Fprintln(cli.Log, "✓ Received federated token from GCP STS")
+	fmt.Fprintf(cli.Log, "  Token type: %s\n", federatedToken.TokenType)
+	fmt.Fprintf(cli.Log, "  Expires in: %d seconds\n", federatedToken.ExpiresIn)
+	fmt.Fprintln(cli.Log)
+
+	printPrincipalIdentifiers(p.PoolPath, jwtSubject(subjectToken, subjectTokenType))
+
+	if p.ServiceAccount == "" {
+		// Workforce identities can call Google APIs with the federated
+		// token directly; impersonation is optional.
+		if err := cli.WriteFile(p.OutputPath, []byte(federatedToken.AccessToken)); err != nil {
+			return "", 0, fmt.Errorf("failed to write access token: %w", err)
+		}
+		fmt.Fprintf(cli.Log, "Federated access token saved to: %s\n", cli.OutputName(p.OutputPath))
+		fmt.Fprintln(cli.Log, "No --service-account given, so the token acts as the workforce identity itself.")
+		return federatedToken.AccessToken, time.Duration(federatedToken.ExpiresIn) * time.Second, nil
+	}
+
+	if p.IDTokenAudience != "" {
+		return mintIDToken(federatedToken.AccessToken, p)
+	}
+
+	fmt.Fprintln(cli.Log, "Step 3b: Exchange federated token for access token")
+	fmt.Fprintln(cli.Log, "Calling GCP STS token endpoint again with service account impersonation...")
+	fmt.Fprintln(cli.Log)
+
+	// Step 3b: Exchange federated token for access token with service account impersonation
+	accessToken, err := exchangeForAccessToken(federatedToken.AccessToken, p.ServiceAccount)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to exchange for access token: %w", err)
+	}
+
+	fmt.Fprintln(cli.Log, "✓ Received GCP access token")
+	fmt.Fprintf(cli.Log, "  Token type: %s\n", accessToken.TokenType)
+	fmt.Fprintf(cli.Log, "  Expires in: %d seconds\n", accessToken.ExpiresIn)
+	fmt.Fprintln(cli.Log)
+
+	if p.Boundary != nil {
+		fmt.Fprintln(cli.Log, "Step 3c: Downscope the access token with a Credential Access Boundary")
+		fmt.Fprintln(cli.Log, "Calling GCP STS token endpoint with the access token as subject...")
+		fmt.Fprintln(cli.Log)
+
+		downscoped, err := downscopeToken(accessToken.AccessToken, p.Boundary)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to downscope access token: %w", err)
+		}
+		// STS may omit expires_in; the downscoped token then lives as long
+		// as its source.
+		if downscoped.ExpiresIn == 0 {
+			downscoped.ExpiresIn = accessToken.ExpiresIn
+		}
+		accessToken = downscoped
+
+		fmt.Fprintln(cli.Log, "✓ Received downscoped access token")
+		fmt.Fprintf(cli.Log, "  Expires in: %d seconds\n", accessToken.ExpiresIn)
+		fmt.Fprintln(cli.Log, "  Only the boundary's roles on its resources remain usable")
+		fmt.Fprintln(cli.Log)
+	}
+
+	// Save the access token
+	if err := cli.WriteFile(p.OutputPath, []byte(accessToken.AccessToken)); err != nil {
+		return "", 0, fmt.Errorf("failed to write access token: %w", err)
+	}
+
+	fmt.Fprintf(cli.Log, "Access token saved to: %s\n", cli.OutputName(p.OutputPath))
+	return accessToken.AccessToken, time.Duration(accessToken.ExpiresIn) * time.Second, nil
+}
+
+func exchangeForFederatedToken(subjectToken, subjectTokenType, audience string, options map[string]string) (*sts.TokenResponse, error) {
+	client := &sts.Client{HTTP: httpClient, BaseURL: netConfig.ServiceURL("sts")}
+
+	requestBody := map[string]string{
+		"audience":           audience,
+		"subject_token_type": subjectTokenType,
+		"subject_token":      subjectToken,
+		"scope":              sts.CloudPlatformScope,
+	}
+	if len(options) > 0 {
+		optionsJSON, err := json.Marshal(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal options: %w", err)
+		}
+		requestBody["options"] = string(optionsJSON)
+	}
+
+	fmt.Fprintln(cli.Log, "  Request details:")
+	fmt.Fprintf(cli.Log, "    Endpoint: %s\n", client.TokenURL())
+	fmt.Fprintf(cli.Log, "    Audience: %s\n", audience)
+	fmt.Fprintf(cli.Log, "    Grant type: token-exchange\n")
+	fmt.Fprintf(cli.Log, "    Subject token type: %s\n", subjectTokenType)
+	if options, ok := requestBody["options"]; ok {
+		fmt.Fprintf(cli.Log, "    Options: %s\n", options)
+	}
+	fmt.Fprintln(cli.Log)
+
+	return client.Exchange(context.Background(), requestBody)
+}
+
+func exchangeForAccessToken(federatedToken, serviceAccountEmail string) (*sts.TokenResponse, error) {
+	client := &iamcredentials.Client{
+		HTTP:        httpClient,
+		BaseURL:     netConfig.ServiceURL("iamcredentials"),
+		AccessToken: federatedToken,
+	}
+
+	fmt.Fprintln(cli.Log, "  Request details:")
+	fmt.Fprintf(cli.Log, "    Endpoint: %s\n", client.MethodURL(serviceAccountEmail, "generateAccessToken"))
+	fmt.Fprintf(cli.Log, "    Method: POST\n")
+	fmt.Fprintf(cli.Log, "    Service Account: %s\n", serviceAccountEmail)
+	fmt.Fprintln(cli.Log)
+
+	saResp, err := client.GenerateAccessToken(context.Background(), serviceAccountEmail, []string{sts.CloudPlatformScope})
+	if err != nil {
+		return nil, err
+	}
+
+	// generateAccessToken defaults to one hour, but report what was issued.
+	expiresIn := 3600
+	if !saResp.ExpireTime.IsZero() {
+		expiresIn = int(time.Until(saResp.ExpireTime).Seconds())
+	}
+
+	return &sts.TokenResponse{
+		AccessToken: saResp.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package exchangetoken
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"wif-poc/internal/apierror"
+	"wif-poc/internal/cli"
+)
+
+// mintIDToken uses the federated token to have IAM Credentials sign an ID
+// token for the service account, saves it and returns it with its lifetime.
+func mintIDToken(federatedToken string, p exchangeParams) (string, time.Duration, error) {
+	fmt.Fprintln(cli.Log, "Step 3b: Generate a Google-signed ID token for the service account")
+	fmt.Fprintln(cli.Log, "Calling IAM Credentials generateIdToken...")
+	fmt.Fprintln(cli.Log)
+
+	idToken, err := generateIDToken(federatedToken, p.ServiceAccount, p.IDTokenAudience, p.IncludeEmail)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate ID token: %w", err)
+	}
+
+	claims, err := decodeJWTClaims(idToken)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	// The lifetime drives --watch and the cache, so a token without exp
+	// can't be used.
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return "", 0, fmt.Errorf("the ID token has no exp claim")
+	}
+	expiresAt := time.Unix(int64(exp), 0)
+
+	fmt.Fprintln(cli.Log, "✓ Received Google-signed ID token")
+	fmt.Fprintf(cli.Log, "  Expires at: %s (in %s)\n", expiresAt.Format(time.RFC3339), time.Until(expiresAt).Round(time.Second))
+	fmt.Fprintln(cli.Log)
+	fmt.Fprintln(cli.Log, "ID token claims:")
+	claimsJSON, _ := json.MarshalIndent(claims, "  ", "  ")
+	fmt.Fprintf(cli.Log, "  %s\n", claimsJSON)
+	fmt.Fprintln(cli.Log)
+
+	if err := cli.WriteFile(p.OutputPath, []byte(idToken)); err != nil {
+		return "", 0, fmt.Errorf("failed to write ID token: %w", err)
+	}
+
+	fmt.Fprintf(cli.Log, "ID token saved to: %s\n", cli.OutputName(p.OutputPath))
+	return idToken, time.Until(expiresAt), nil
+}
+
+func generateIDToken(federatedToken, serviceAccountEmail, audience string, includeEmail bool) (string, error) {
+	url := fmt.Sprintf(
+		"%s/v1/projects/-/serviceAccounts/%s:generateIdToken",
+		netConfig.ServiceURL("iamcredentials"),
+		serviceAccountEmail,
+	)
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"audience":     audience,
+		"includeEmail": includeEmail,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	fmt.Fprintln(cli.Log, "  Request details:")
+	fmt.Fprintf(cli.Log, "    Endpoint: %s\n", url)
+	fmt.Fprintf(cli.Log, "    Method: POST\n")
+	fmt.Fprintf(cli.Log, "    Service Account: %s\n", serviceAccountEmail)
+	fmt.Fprintf(cli.Log, "    Audience: %s\n", audience)
+	fmt.Fprintf(cli.Log, "    Include email: %t\n", includeEmail)
+	fmt.Fprintln(cli.Log)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+federatedToken)
+	header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(context.Background(), "POST", url, header, jsonData)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", apierror.Parse("IAM Credentials", resp.StatusCode, resp.Body)
+	}
+
+	var idResp struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(resp.Body, &idResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	return idResp.Token, nil
+}
+
+// decodeJWTClaims returns the payload of a JWT without verifying it.
+func decodeJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a JWT: expected 3 parts, got %d", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload encoding: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid payload JSON: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,48 @@
+package exchangetoken
+
+import (
+	"fmt"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/sts"
+)
+
+// poolResourcePath returns the pool part of principal identifiers, e.g.
+// "projects/123/locations/global/workloadIdentityPools/my-pool".
+func poolResourcePath(poolType, projectNumber, poolID string) string {
+	if poolType == "workforce" {
+		return fmt.Sprintf("locations/global/workforcePools/%s", poolID)
+	}
+	return fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s", projectNumber, poolID)
+}
+
+// printPrincipalIdentifiers shows the member strings that can be used in IAM
+// bindings for identities from the pool.
+func printPrincipalIdentifiers(poolPath, subject string) {
+	if subject == "" {
+		subject = "SUBJECT"
+	}
+	base := "//iam.googleapis.com/" + poolPath
+
+	fmt.Fprintln(cli.Log, "  Principal identifiers for IAM bindings:")
+	fmt.Fprintf(cli.Log, "    Single identity:  principal:%s/subject/%s\n", base, subject)
+	fmt.Fprintf(cli.Log, "    Group:            principalSet:%s/group/GROUP_ID\n", base)
+	fmt.Fprintf(cli.Log, "    Attribute value:  principalSet:%s/attribute.ATTRIBUTE_NAME/ATTRIBUTE_VALUE\n", base)
+	fmt.Fprintf(cli.Log, "    All identities:   principalSet:%s/*\n", base)
+	fmt.Fprintln(cli.Log)
+}
+
+// jwtSubject returns the unverified "sub" claim of a JWT subject token, which
+// is the google.subject value with the default assertion.sub mapping.
+func jwtSubject(subjectToken, subjectTokenType string) string {
+	if subjectTokenType != sts.TokenTypeJWT {
+		return ""
+	}
+
+	claims, err := decodeJWTClaims(subjectToken)
+	if err != nil {
+		return ""
+	}
+	sub, _ := claims["sub"].(string)
+	return sub
+}
@@ -0,0 +1,169 @@
+package exchangetoken
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/sts"
+)
+
+const defaultK8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// subjectTokenSource supplies the token presented to STS in the first
+// exchange. SubjectToken is called again for every refresh.
+type subjectTokenSource interface {
+	SubjectToken() (string, error)
+	TokenType() string
+}
+
+// rotatingSource is implemented by sources whose token can be replaced
+// underneath us, so --watch can refresh as soon as that happens.
+type rotatingSource interface {
+	Rotated() bool
+}
+
+// callerSource is implemented by sources whose subject token is signed
+// anew on every call, and which instead name the stable identity behind it
+// for the token cache, e.g. an AWS role ARN. Caller is valid after
+// SubjectToken and returns "" when the identity is unknown.
+type callerSource interface {
+	Caller() string
+}
+
+// fileSource reads a JWT or SAML assertion written by create-jwt or
+// create-saml, from stdin when Path is "-".
+type fileSource struct {
+	Path string
+	Type string
+}
+
+func (s *fileSource) TokenType() string {
+	return s.Type
+}
+
+func (s *fileSource) SubjectToken() (string, error) {
+	data, err := cli.ReadFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+	if s.Type == sts.TokenTypeSAML2 {
+		return samlSubjectToken(data), nil
+	}
+	// A piped token usually ends with a newline, which STS rejects.
+	return strings.TrimSpace(string(data)), nil
+}
+
+// samlSubjectToken returns the base64-encoded assertion STS expects. Files
+// from create-saml are already encoded; raw XML assertions are encoded here.
+func samlSubjectToken(data []byte) string {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "<") {
+		return base64.StdEncoding.EncodeToString([]byte(trimmed))
+	}
+	return trimmed
+}
+
+// k8sSource reads a projected Kubernetes service account token. The kubelet
+// rotates the file in place, so the token is re-read on every call and the
+// modification time is tracked to detect rotation.
+type k8sSource struct {
+	Path    string
+	modTime time.Time
+}
+
+func (s *k8sSource) TokenType() string {
+	return sts.TokenTypeJWT
+}
+
+func (s *k8sSource) SubjectToken() (string, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("service account token file %s is empty", s.Path)
+	}
+
+	s.modTime = info.ModTime()
+	fmt.Fprintf(cli.Log, "Read projected service account token from %s\n", s.Path)
+	fmt.Fprintln(cli.Log)
+	return token, nil
+}
+
+func (s *k8sSource) Rotated() bool {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(s.modTime)
+}
+
+// githubSource requests an OIDC token from the GitHub Actions runtime. The
+// runner exposes the endpoint and a bearer token to jobs with
+// "permissions: id-token: write".
+type githubSource struct {
+	Audience string
+}
+
+func (s *githubSource) TokenType() string {
+	return sts.TokenTypeJWT
+}
+
+func (s *githubSource) SubjectToken() (string, error) {
+	requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return "", fmt.Errorf("ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN must be set (does the job have id-token: write permission?)")
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("audience", s.Audience)
+	u.RawQuery = query.Encode()
+
+	fmt.Fprintln(cli.Log, "Requesting OIDC token from the GitHub Actions runtime...")
+	fmt.Fprintf(cli.Log, "  Audience: %s\n", s.Audience)
+	fmt.Fprintln(cli.Log)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+requestToken)
+	header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(context.Background(), "GET", u.String(), header, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub Actions token error (status %d): %s", resp.StatusCode, string(resp.Body))
+	}
+
+	var tokenResp struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(resp.Body, &tokenResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if tokenResp.Value == "" {
+		return "", fmt.Errorf("GitHub Actions runtime returned an empty token")
+	}
+	return tokenResp.Value, nil
+}
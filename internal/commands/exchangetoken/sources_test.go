@@ -0,0 +1,87 @@
+package exchangetoken
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wif-poc/internal/httpclient"
+)
+
+// useTestHTTPClient makes the sources send requests without retrying, for
+// the duration of the test.
+func useTestHTTPClient(t *testing.T) {
+	t.Helper()
+	saved := httpClient
+	t.Cleanup(func() { httpClient = saved })
+	httpClient = httpclient.New()
+	httpClient.MaxAttempts = 1
+}
+
+// fakeGitHubRuntime serves the GitHub Actions ID token endpoint, minting
+// "token-for-<audience>" for requests with the job's bearer token.
+func fakeGitHubRuntime(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer job-request-token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		// The runner's URL already has a query the audience is added to.
+		if r.URL.Query().Get("api-version") != "2.0" {
+			http.Error(w, `{"message":"api-version lost"}`, http.StatusBadRequest)
+			return
+		}
+		audience := r.URL.Query().Get("audience")
+		if audience == "empty" {
+			w.Write([]byte(`{"value":""}`))
+			return
+		}
+		w.Write([]byte(`{"count":1,"value":"token-for-` + audience + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	useTestHTTPClient(t)
+	return server
+}
+
+func TestGitHubSource(t *testing.T) {
+	server := fakeGitHubRuntime(t)
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", server.URL+"/_apis/token?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "job-request-token")
+
+	src := &githubSource{Audience: "https://iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/github"}
+	token, err := src.SubjectToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "token-for-" + src.Audience; token != want {
+		t.Errorf("SubjectToken() = %q, want %q", token, want)
+	}
+}
+
+func TestGitHubSourceErrors(t *testing.T) {
+	server := fakeGitHubRuntime(t)
+	tests := []struct {
+		name     string
+		url      string
+		token    string
+		audience string
+		want     string
+	}{
+		{"no request URL", "", "job-request-token", "gcp", "ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN must be set"},
+		{"no request token", server.URL + "/?api-version=2.0", "", "gcp", "id-token: write"},
+		{"wrong request token", server.URL + "/?api-version=2.0", "other", "gcp", "status 401"},
+		{"empty token", server.URL + "/?api-version=2.0", "job-request-token", "empty", "empty token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", tt.url)
+			t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", tt.token)
+			_, err := (&githubSource{Audience: tt.audience}).SubjectToken()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("SubjectToken() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
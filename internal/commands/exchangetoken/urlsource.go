@@ -0,0 +1,102 @@
+package exchangetoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/sts"
+)
+
+// urlSource fetches the subject token from an HTTP endpoint, like the url
+// credential source of external_account credentials. The response is either
+// the token itself or a JSON document with the token at FieldPath.
+type urlSource struct {
+	URL       string
+	Headers   []string
+	FieldPath string
+	Type      string
+}
+
+func (s *urlSource) TokenType() string {
+	return s.Type
+}
+
+func (s *urlSource) SubjectToken() (string, error) {
+	fmt.Fprintln(cli.Log, "Fetching subject token from URL...")
+	fmt.Fprintf(cli.Log, "  URL: %s\n", s.URL)
+	if s.FieldPath != "" {
+		fmt.Fprintf(cli.Log, "  JSON field: %s\n", s.FieldPath)
+	}
+	fmt.Fprintln(cli.Log)
+
+	body, err := s.fetch()
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(body))
+	if s.FieldPath != "" {
+		token, err = jsonField(body, s.FieldPath)
+		if err != nil {
+			return "", err
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("token URL returned an empty token")
+	}
+
+	if s.Type == sts.TokenTypeSAML2 {
+		return samlSubjectToken([]byte(token)), nil
+	}
+	return token, nil
+}
+
+// fetch GETs the token URL. The shared client retries network errors, 429
+// and 5xx responses with exponential backoff.
+func (s *urlSource) fetch() ([]byte, error) {
+	header := http.Header{}
+	for _, h := range s.Headers {
+		name, value, _ := strings.Cut(h, ":")
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	resp, err := httpClient.Do(context.Background(), "GET", s.URL, header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token URL error (status %d): %s", resp.StatusCode, string(resp.Body))
+	}
+	return resp.Body, nil
+}
+
+// jsonField walks a dot-separated path such as "data.id_token" through a
+// JSON document and returns the string found there.
+func jsonField(body []byte, path string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "", fmt.Errorf("failed to parse token URL response as JSON: %w", err)
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("field %q: parent of %q is not an object", path, key)
+		}
+		value, ok = object[key]
+		if !ok {
+			return "", fmt.Errorf("field %q not found in token URL response", path)
+		}
+	}
+
+	token, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is not a string", path)
+	}
+	return token, nil
+}
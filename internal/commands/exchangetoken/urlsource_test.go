@@ -0,0 +1,101 @@
+package exchangetoken
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wif-poc/internal/sts"
+)
+
+// fakeTokenEndpoint serves the subject token in several formats, to
+// requests with the metadata headers a cloud metadata server would require.
+func fakeTokenEndpoint(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.Header.Get("X-Request-Id") != "a: b" {
+			http.Error(w, "missing metadata headers", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/text":
+			w.Write([]byte("  text-token\n"))
+		case "/json":
+			w.Write([]byte(`{"access_token":"json-token","expires_in":3599}`))
+		case "/nested":
+			w.Write([]byte(`{"data":{"id_token":"nested-token","count":2}}`))
+		case "/saml":
+			w.Write([]byte("<samlp:Response>assertion</samlp:Response>\n"))
+		case "/empty":
+		case "/unavailable":
+			http.Error(w, "token service unavailable", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	useTestHTTPClient(t)
+	return server
+}
+
+var testTokenHeaders = []string{"Metadata: true", "X-Request-Id:a: b"}
+
+func TestURLSource(t *testing.T) {
+	server := fakeTokenEndpoint(t)
+	tests := []struct {
+		name      string
+		path      string
+		fieldPath string
+		tokenType string
+		want      string
+	}{
+		{"text", "/text", "", sts.TokenTypeJWT, "text-token"},
+		{"JSON field", "/json", "access_token", sts.TokenTypeJWT, "json-token"},
+		{"nested JSON field", "/nested", "data.id_token", sts.TokenTypeJWT, "nested-token"},
+		{"SAML", "/saml", "", sts.TokenTypeSAML2, base64.StdEncoding.EncodeToString([]byte("<samlp:Response>assertion</samlp:Response>"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &urlSource{URL: server.URL + tt.path, Headers: testTokenHeaders, FieldPath: tt.fieldPath, Type: tt.tokenType}
+			token, err := src.SubjectToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.want {
+				t.Errorf("SubjectToken() = %q, want %q", token, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLSourceErrors(t *testing.T) {
+	server := fakeTokenEndpoint(t)
+	tests := []struct {
+		name      string
+		path      string
+		headers   []string
+		fieldPath string
+		want      string
+	}{
+		{"missing headers", "/text", nil, "", "status 403"},
+		{"server error", "/unavailable", testTokenHeaders, "", "status 503): token service unavailable"},
+		{"not found", "/missing", testTokenHeaders, "", "status 404"},
+		{"empty", "/empty", testTokenHeaders, "", "empty token"},
+		{"text for a JSON field", "/text", testTokenHeaders, "access_token", "failed to parse token URL response as JSON"},
+		{"missing field", "/json", testTokenHeaders, "id_token", `field "id_token" not found`},
+		{"field not a string", "/json", testTokenHeaders, "expires_in", "is not a string"},
+		{"path through a string", "/json", testTokenHeaders, "access_token.value", "is not an object"},
+		{"nested field not a string", "/nested", testTokenHeaders, "data.count", "is not a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &urlSource{URL: server.URL + tt.path, Headers: tt.headers, FieldPath: tt.fieldPath, Type: sts.TokenTypeJWT}
+			_, err := src.SubjectToken()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("SubjectToken() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
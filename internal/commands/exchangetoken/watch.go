@@ -0,0 +1,49 @@
+package exchangetoken
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"wif-poc/internal/cli"
+)
+
+const (
+	watchPollInterval = 10 * time.Second
+	watchRetryDelay   = 30 * time.Second
+)
+
+// watchAndRefresh keeps the output token fresh until interrupted. It repeats
+// the exchange shortly before the token expires, and immediately when a
+// rotating source (e.g. a projected service account token) changes.
+func watchAndRefresh(src subjectTokenSource, p exchangeParams, margin time.Duration) {
+	for {
+		lifetime, err := runExchange(src, p)
+
+		// A lifetime at or below the margin would refresh at once, forever;
+		// wait at least half the lifetime, and never less than the retry delay.
+		refreshAt := time.Now().Add(max(lifetime-margin, lifetime/2, watchRetryDelay))
+		if err != nil {
+			cli.PrintError(os.Stderr, err)
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintln(os.Stderr, "Make sure to run create-jwt first!")
+			}
+			fmt.Fprintf(os.Stderr, "Retrying in %s...\n", watchRetryDelay)
+			refreshAt = time.Now().Add(watchRetryDelay)
+		} else {
+			fmt.Fprintf(cli.Log, "Next refresh at %s\n", refreshAt.Format(time.RFC3339))
+		}
+		fmt.Fprintln(cli.Log)
+
+		rotating, _ := src.(rotatingSource)
+		for time.Now().Before(refreshAt) {
+			time.Sleep(watchPollInterval)
+			if rotating != nil && rotating.Rotated() {
+				fmt.Fprintln(cli.Log, "Subject token rotated, refreshing...")
+				fmt.Fprintln(cli.Log)
+				break
+			}
+		}
+	}
+}
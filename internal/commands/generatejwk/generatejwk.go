@@ -0,0 +1,151 @@
+// Package generatejwk implements "wif jwk" (generate-jwk).
+package generatejwk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/keys"
+	"wif-poc/internal/output"
+)
+
+// Command converts the public key to the JWK and JWKS files GCP verifies
+// JWTs with.
+var Command = &cli.Command{
+	Name:     "jwk",
+	Binary:   "generate-jwk",
+	Summary:  "Convert the public key to JWK and JWKS files for the OIDC provider",
+	Synopsis: []string{"--key-id <KEY_ID> --public-key <PATH> --jwk-output <PATH> --jwks-output <PATH>"},
+	Examples: []string{"--key-id key-1 --public-key public_key.pem --jwk-output public_key.jwk --jwks-output public_key.jwks"},
+	Setup:    setup,
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// result is the --print document.
+type result struct {
+	KeyID    string `json:"keyId"`
+	JWKPath  string `json:"jwkPath"`
+	JWKSPath string `json:"jwksPath"`
+	JWK      JWK    `json:"jwk"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	keyID := fs.String("key-id", "", "Key ID for the JWK (required)")
+	publicKeyPath := fs.String("public-key", "", "Path to the public key PEM file (required)")
+	jwkPath := fs.String("jwk-output", "", "Path to save the JWK file (required)")
+	jwksPath := fs.String("jwks-output", "", "Path to save the JWKS file (required)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+
+	return func() {
+		if *keyID == "" || *publicKeyPath == "" || *jwkPath == "" || *jwksPath == "" {
+			cli.Fail(fs, "--key-id, --public-key, --jwk-output, and --jwks-output are required")
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		fmt.Fprintln(cli.Log, "=== Step 1b: Converting Public Key to JWK Format ===")
+		fmt.Fprintln(cli.Log, "GCP requires JWK format for JWT signature verification")
+		fmt.Fprintln(cli.Log)
+
+		// Read the RSA public key
+		publicKey, err := keys.LoadPublicKey(*publicKeyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading public key: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Run generate-keys first to generate the key pair")
+			os.Exit(1)
+		}
+
+		// Convert to JWK format
+		n := base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+
+		jwk := JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Kid: *keyID,
+			Alg: "RS256",
+			N:   n,
+			E:   e,
+		}
+
+		jwks := JWKS{
+			Keys: []JWK{jwk},
+		}
+
+		// Write individual JWK file
+		jwkJSON, err := json.MarshalIndent(jwk, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JWK: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := os.WriteFile(*jwkPath, jwkJSON, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JWK file: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Write JWKS file
+		jwksJSON, err := json.MarshalIndent(jwks, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JWKS: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := os.WriteFile(*jwksPath, jwksJSON, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JWKS file: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(cli.Log, "✓ Generated %s (single JWK)\n", *jwkPath)
+		fmt.Fprintf(cli.Log, "✓ Generated %s (JWK Set - upload this to GCP)\n", *jwksPath)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "JWK content:")
+		fmt.Fprintln(cli.Log, string(jwkJSON))
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "JWKS content:")
+		fmt.Fprintln(cli.Log, string(jwksJSON))
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "To use with GCP Workload Identity Federation:")
+		fmt.Fprintln(cli.Log, "1. Host the public_key.jwks file at a publicly accessible HTTPS URL")
+		fmt.Fprintln(cli.Log, "2. Configure the provider with --jwk-json-path=<URL to your JWKS>")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Run the following command to create a JWT token:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/create-jwt --key-id <KEY_ID> --issuer <ISSUER_URL> --audience <AUDIENCE> --subject <SUBJECT> --email <EMAIL> --environment <ENV>")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Example:")
+		fmt.Fprintf(cli.Log, "  ./bin/create-jwt --key-id %s --issuer https://my-external-idp.example.com --audience gcp-workload-identity --subject external-user-123 --email user@example.com --environment production\n", *keyID)
+
+		if *printFormat != "" {
+			r := result{KeyID: *keyID, JWKPath: *jwkPath, JWKSPath: *jwksPath, JWK: jwk}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package generatekeys implements "wif keys generate" (generate-keys).
+package generatekeys
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/output"
+)
+
+// Command generates the RSA key pair of the simulated identity provider.
+var Command = &cli.Command{
+	Name:     "keys generate",
+	Binary:   "generate-keys",
+	Summary:  "Generate the RSA key pair that signs the external identity provider's JWTs",
+	Synopsis: []string{"--private-key <PATH> --public-key <PATH>"},
+	Examples: []string{"--private-key private_key.pem --public-key public_key.pem"},
+	Setup:    setup,
+}
+
+// result is the --print document.
+type result struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+	Algorithm  string `json:"algorithm"`
+	KeySize    int    `json:"keySize"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	privateKeyPath := fs.String("private-key", "", "Path to save the private key (required)")
+	publicKeyPath := fs.String("public-key", "", "Path to save the public key (required)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+
+	return func() {
+		if *privateKeyPath == "" || *publicKeyPath == "" {
+			cli.Fail(fs, "--private-key and --public-key are required")
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		fmt.Fprintln(cli.Log, "=== Step 1: Generating RSA Key Pair ===")
+		fmt.Fprintln(cli.Log, "This key pair will be used to sign JWT tokens from our 'external' identity provider")
+		fmt.Fprintln(cli.Log)
+
+		// Generate 2048-bit RSA key pair
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating key: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Export private key to PEM format
+		privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
+		privateKeyPEM := &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: privateKeyBytes,
+		}
+
+		privateKeyFile, err := os.Create(*privateKeyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating private key file: %v\n", err)
+			os.Exit(1)
+		}
+		defer privateKeyFile.Close()
+
+		if err := pem.Encode(privateKeyFile, privateKeyPEM); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing private key: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Export public key to PEM format
+		publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling public key: %v\n", err)
+			os.Exit(1)
+		}
+
+		publicKeyPEM := &pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: publicKeyBytes,
+		}
+
+		publicKeyFile, err := os.Create(*publicKeyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating public key file: %v\n", err)
+			os.Exit(1)
+		}
+		defer publicKeyFile.Close()
+
+		if err := pem.Encode(publicKeyFile, publicKeyPEM); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing public key: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(cli.Log, "✓ Generated %s (keep this secret!)\n", *privateKeyPath)
+		fmt.Fprintf(cli.Log, "✓ Generated %s (you'll upload this to GCP)\n", *publicKeyPath)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Run the following command to generate JWK format:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/generate-jwk --key-id <YOUR_KEY_ID>")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Example:")
+		fmt.Fprintln(cli.Log, "  ./bin/generate-jwk --key-id key-1")
+
+		if *printFormat != "" {
+			r := result{PrivateKey: *privateKeyPath, PublicKey: *publicKeyPath, Algorithm: "RS256", KeySize: privateKey.N.BitLen()}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package inspect implements "wif token inspect" (inspect).
+package inspect
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+)
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+// Command decodes a JWT or looks up an access token.
+var Command = &cli.Command{
+	Name:     "token inspect",
+	Binary:   "inspect",
+	Summary:  "Decode a JWT or ID token, or look up an access token with tokeninfo",
+	Synopsis: []string{"--token-input <PATH> [--print json|yaml|table]"},
+	Notes: []string{
+		"JWTs are decoded locally without verifying the signature. Opaque access tokens are\n" +
+			"looked up with Google's tokeninfo endpoint, which the network flags apply to.",
+	},
+	Examples: []string{
+		"--token-input external_token.jwt",
+		"--token-input gcp_access_token.txt --print json | jq .expiresInSeconds",
+	},
+	Setup: setup,
+}
+
+// inspection is what inspect reports about a token, and the --print
+// document.
+type inspection struct {
+	Type     string                 `json:"type"` // jwt or access_token
+	Header   map[string]interface{} `json:"header,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	Issuer   string                 `json:"issuer,omitempty"`
+	Subject  string                 `json:"subject,omitempty"`
+	Email    string                 `json:"email,omitempty"`
+	Audience []string               `json:"audience,omitempty"`
+	Scopes   []string               `json:"scopes,omitempty"`
+	IssuedAt *time.Time             `json:"issuedAt,omitempty"`
+	// The expiry fields are null for a token without exp, which never
+	// expires.
+	ExpiresAt *time.Time `json:"expiresAt"`
+	ExpiresIn *int64     `json:"expiresInSeconds"` // negative once expired
+	Expired   *bool      `json:"expired"`
+}
+
+func (i *inspection) setExpiry(t time.Time) {
+	expiresIn := int64(time.Until(t).Seconds())
+	expired := expiresIn <= 0
+	i.ExpiresAt, i.ExpiresIn, i.Expired = &t, &expiresIn, &expired
+}
+
+// expired reports whether the token has an expiry that has passed.
+func (i *inspection) expired() bool {
+	return i.Expired != nil && *i.Expired
+}
+
+func setup(fs *flag.FlagSet) func() {
+	tokenPath := fs.String("token-input", "", "Path to the JWT from create-jwt, or the ID token or access token from exchange-token, - for stdin (required)")
+	printFormat := fs.String("print", "", "Print only the result as json, yaml or table, for scripts")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		if *tokenPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		token, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading token: %v\n", err)
+			os.Exit(1)
+		}
+		if token == "" {
+			fmt.Fprintf(os.Stderr, "Error: %s is empty\n", *tokenPath)
+			os.Exit(1)
+		}
+		if looksLikeSAML(token) {
+			fmt.Fprintln(os.Stderr, "Error: this looks like a SAML assertion; inspect handles JWTs and access tokens")
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log, "=== Inspecting Token ===")
+
+		var result *inspection
+		if strings.Count(token, ".") == 2 {
+			fmt.Fprintln(cli.Log, "Token type: JWT (decoded locally; the signature is NOT verified)")
+			fmt.Fprintln(cli.Log)
+			result, err = inspectJWT(token)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error decoding JWT: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			fmt.Fprintln(cli.Log, "Token type: opaque access token (asking Google's tokeninfo endpoint)")
+			fmt.Fprintf(cli.Log, "  URL: %s\n", tokenInfoURL())
+			fmt.Fprintln(cli.Log)
+
+			httpClient, err = netConfig.NewClient()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+				os.Exit(1)
+			}
+			// Retry notices go to stderr so they never mix with --print results.
+			httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+			info, err := lookupTokenInfo(context.Background(), token)
+			if err != nil {
+				cli.PrintError(os.Stderr, fmt.Errorf("failed to look up token: %w", err))
+				fmt.Fprintln(os.Stderr, "The token is expired, revoked, or not a Google OAuth access token.")
+				os.Exit(1)
+			}
+			result = inspectAccessToken(info)
+		}
+
+		if *printFormat != "" {
+			if err := output.Document(os.Stdout, *printFormat, result); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		printSummary(result)
+	}
+}
+
+// inspectJWT decodes a JWT's header and claims without verifying it.
+func inspectJWT(token string) (*inspection, error) {
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &inspection{Type: "jwt", Header: parsed.Header, Claims: claims}
+	result.Issuer, _ = claims.GetIssuer()
+	result.Subject, _ = claims.GetSubject()
+	result.Email, _ = claims["email"].(string)
+	if aud, err := claims.GetAudience(); err == nil {
+		result.Audience = aud
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		result.IssuedAt = &iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.setExpiry(exp.Time)
+	}
+	return result, nil
+}
+
+// looksLikeSAML reports whether the token is an XML assertion, raw or in
+// the base64 form exchange-token sends to STS.
+func looksLikeSAML(token string) bool {
+	if strings.HasPrefix(token, "<") {
+		return true
+	}
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	return err == nil && strings.HasPrefix(strings.TrimSpace(string(decoded)), "<")
+}
+
+func printJSON(title string, v interface{}) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Printf("%s:\n%s\n\n", title, data)
+}
+
+func printSummary(r *inspection) {
+	if r.Type == "jwt" {
+		printJSON("Header", r.Header)
+		printJSON("Claims", r.Claims)
+	}
+
+	fmt.Println("Summary:")
+	if r.Issuer != "" {
+		fmt.Printf("  Issuer: %s\n", r.Issuer)
+	}
+	if r.Subject != "" {
+		fmt.Printf("  Subject: %s\n", r.Subject)
+	}
+	if r.Email != "" {
+		fmt.Printf("  Email: %s\n", r.Email)
+	}
+	if len(r.Audience) > 0 {
+		fmt.Printf("  Audience: %s\n", strings.Join(r.Audience, ", "))
+	}
+	if len(r.Scopes) > 0 {
+		fmt.Println("  Scopes:")
+		for _, scope := range r.Scopes {
+			fmt.Printf("    - %s\n", scope)
+		}
+	}
+	if r.IssuedAt != nil {
+		fmt.Printf("  Issued at: %s (%s ago)\n", r.IssuedAt.Local().Format(time.RFC3339), time.Since(*r.IssuedAt).Round(time.Second))
+	}
+	switch {
+	case r.ExpiresAt == nil:
+		fmt.Println("  Expires: never (no exp claim)")
+	case r.expired():
+		fmt.Printf("  Expires at: %s (EXPIRED %s ago)\n", r.ExpiresAt.Local().Format(time.RFC3339), time.Since(*r.ExpiresAt).Round(time.Second))
+	default:
+		fmt.Printf("  Expires at: %s (in %s)\n", r.ExpiresAt.Local().Format(time.RFC3339), time.Until(*r.ExpiresAt).Round(time.Second))
+	}
+	fmt.Println()
+
+	fmt.Fprintln(cli.Log, "=== Next Step ===")
+	switch {
+	case r.expired() && r.Type == "jwt":
+		fmt.Fprintln(cli.Log, "The token has expired. Mint a new one with create-jwt (or exchange-token for ID tokens).")
+	case r.expired():
+		fmt.Fprintln(cli.Log, "The token has expired. Get a new one with exchange-token.")
+	case r.Type == "jwt" && (r.Issuer == "https://accounts.google.com" || r.Issuer == "accounts.google.com"):
+		fmt.Fprintln(cli.Log, "This is a Google-signed ID token. Send it to the service it was minted for:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  curl -H \"Authorization: Bearer $(cat <PATH>)\" <AUDIENCE_URL>")
+	case r.Type == "jwt":
+		fmt.Fprintln(cli.Log, "Check that iss and aud match the provider's --issuer-uri and --allowed-audiences, then exchange it:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/exchange-token --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --token-input <PATH> --output <PATH>")
+	default:
+		fmt.Fprintln(cli.Log, "Use the access token to call an API:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/call /v1/projects/<PROJECT_ID>/topics --service pubsub --token-input <PATH>")
+	}
+}
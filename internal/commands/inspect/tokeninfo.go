@@ -0,0 +1,85 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"wif-poc/internal/apierror"
+)
+
+// tokenInfo is the tokeninfo endpoint's view of an access token. The
+// endpoint encodes numbers and booleans as strings.
+type tokenInfo struct {
+	AuthorizedParty string `json:"azp"`
+	Audience        string `json:"aud"`
+	Subject         string `json:"sub"`
+	Scope           string `json:"scope"`
+	Exp             string `json:"exp"`
+	ExpiresIn       string `json:"expires_in"`
+	Email           string `json:"email"`
+	EmailVerified   string `json:"email_verified"`
+}
+
+// tokenInfoURL returns the endpoint, which honors --endpoint-base and
+// --universe-domain like the other APIs.
+func tokenInfoURL() string {
+	return netConfig.ServiceURL("oauth2") + "/tokeninfo"
+}
+
+// lookupTokenInfo asks Google about an opaque access token. The token goes
+// in a POST body rather than the query string, so it doesn't end up in
+// proxy or server logs.
+func lookupTokenInfo(ctx context.Context, accessToken string) (*tokenInfo, error) {
+	resp, err := httpClient.PostForm(ctx, tokenInfoURL(), url.Values{"access_token": {accessToken}})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.Parse("Token Info", resp.StatusCode, resp.Body)
+	}
+
+	var info tokenInfo
+	if err := json.Unmarshal(resp.Body, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &info, nil
+}
+
+// inspectAccessToken describes an opaque access token from its tokeninfo.
+func inspectAccessToken(info *tokenInfo) *inspection {
+	result := &inspection{
+		Type:     "access_token",
+		Subject:  info.Subject,
+		Email:    info.Email,
+		Audience: []string{},
+		Scopes:   strings.Fields(info.Scope),
+	}
+	for _, aud := range []string{info.Audience, info.AuthorizedParty} {
+		if aud != "" && !contains(result.Audience, aud) {
+			result.Audience = append(result.Audience, aud)
+		}
+	}
+
+	if exp, err := strconv.ParseInt(info.Exp, 10, 64); err == nil {
+		result.setExpiry(time.Unix(exp, 0))
+	} else if seconds, err := strconv.Atoi(info.ExpiresIn); err == nil {
+		result.setExpiry(time.Now().Add(time.Duration(seconds) * time.Second))
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Package k8sjwks implements "wif k8s jwks" (k8s-jwks).
+package k8sjwks
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/output"
+)
+
+const (
+	inClusterServer    = "https://kubernetes.default.svc"
+	inClusterTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAPath    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// Command fetches a Kubernetes cluster's service account issuer and JWKS.
+var Command = &cli.Command{
+	Name:     "k8s jwks",
+	Binary:   "k8s-jwks",
+	Summary:  "Fetch a Kubernetes cluster's service account issuer and JWKS for an OIDC provider",
+	Synopsis: []string{"--jwks-output <PATH> [--server <URL>] [--token-file <PATH>] [--ca-file <PATH>]"},
+	Notes:    []string{"Defaults read the in-cluster service account token and CA, so inside a pod only --jwks-output is needed."},
+	Examples: []string{"--server https://127.0.0.1:6443 --token-file admin.token --ca-file ca.crt --jwks-output cluster.jwks"},
+	Setup:    setup,
+}
+
+type OpenIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type JWKS struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Alg string `json:"alg"`
+	} `json:"keys"`
+}
+
+// result is the --print document.
+type result struct {
+	Issuer   string   `json:"issuer"`
+	JWKSURI  string   `json:"jwksUri"`
+	JWKSPath string   `json:"jwksPath"`
+	KeyIDs   []string `json:"keyIds"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	server := fs.String("server", inClusterServer, "Kubernetes API server URL")
+	tokenPath := fs.String("token-file", inClusterTokenPath, "Bearer token for the API server, - for stdin (empty for anonymous)")
+	caPath := fs.String("ca-file", inClusterCAPath, "CA bundle for the API server certificate (empty for system roots)")
+	jwksPath := fs.String("jwks-output", "", "Path to save the cluster JWKS file (required)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+
+	return func() {
+		if *jwksPath == "" {
+			cli.Fail(fs, "--jwks-output is required")
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		fmt.Fprintln(cli.Log, "=== Step 1 (Kubernetes): Fetching Cluster Service Account Issuer and JWKS ===")
+		fmt.Fprintln(cli.Log, "The cluster signs projected service account tokens; GCP needs its public keys")
+		fmt.Fprintln(cli.Log)
+
+		// Outside a pod the in-cluster token and CA don't exist. Go on
+		// without them, which works for clusters serving discovery
+		// anonymously, but say so: a 401 or certificate error that follows
+		// is otherwise hard to place.
+		var missingDefaults []string
+		if *caPath == inClusterCAPath {
+			if _, err := os.Stat(inClusterCAPath); err != nil {
+				fmt.Fprintf(cli.Log, "In-cluster CA not found (%v); trusting the system roots\n", err)
+				missingDefaults = append(missingDefaults, "CA "+inClusterCAPath)
+				*caPath = ""
+			}
+		}
+		client, err := newClient(*caPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+
+		var bearer string
+		if *tokenPath != "" {
+			data, err := cli.ReadFile(*tokenPath)
+			switch {
+			case err == nil:
+				bearer = strings.TrimSpace(string(data))
+			case *tokenPath == inClusterTokenPath:
+				fmt.Fprintf(cli.Log, "In-cluster service account token not found (%v); calling the API server anonymously\n", err)
+				missingDefaults = append(missingDefaults, "token "+inClusterTokenPath)
+			default:
+				fmt.Fprintf(os.Stderr, "Error reading token file: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if len(missingDefaults) > 0 {
+			fmt.Fprintln(cli.Log)
+		}
+
+		discovery, jwks, jwksBody, err := fetchJWKS(client, strings.TrimSuffix(*server, "/"), bearer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if len(missingDefaults) > 0 {
+				fmt.Fprintf(os.Stderr, "The in-cluster defaults were not found (%s), so the request went without them.\n", strings.Join(missingDefaults, ", "))
+				fmt.Fprintln(os.Stderr, "Outside a pod, pass --server, --token-file and --ca-file for the cluster.")
+			}
+			os.Exit(1)
+		}
+
+		var jwksJSON bytes.Buffer
+		if err := json.Indent(&jwksJSON, jwksBody, "", "  "); err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting JWKS: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := os.WriteFile(*jwksPath, jwksJSON.Bytes(), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JWKS file: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(cli.Log, "✓ Issuer: %s\n", discovery.Issuer)
+		fmt.Fprintf(cli.Log, "✓ JWKS URI advertised: %s\n", discovery.JWKSURI)
+		fmt.Fprintf(cli.Log, "✓ Generated %s (%d key(s) - upload this to GCP)\n", *jwksPath, len(jwks.Keys))
+		for _, key := range jwks.Keys {
+			fmt.Fprintf(cli.Log, "  - kid=%s kty=%s alg=%s\n", key.Kid, key.Kty, key.Alg)
+		}
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "JWKS content:")
+		fmt.Fprintln(cli.Log, jwksJSON.String())
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Create an OIDC provider that trusts the cluster issuer:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintf(cli.Log, "  gcloud iam workload-identity-pools providers create-oidc <PROVIDER_ID> --location=global --workload-identity-pool=<POOL_ID> --issuer-uri=%q --attribute-mapping=\"google.subject=assertion.sub\" --jwk-json-path=%s\n", discovery.Issuer, *jwksPath)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Mount a projected token whose audience matches the provider, then run:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/exchange-token --source k8s --k8s-token-path <PATH> --watch --project-number <PROJECT_NUMBER> --pool-id <POOL_ID> --provider-id <PROVIDER_ID> --service-account <SERVICE_ACCOUNT_EMAIL> --output <PATH>")
+
+		if *printFormat != "" {
+			r := result{Issuer: discovery.Issuer, JWKSURI: discovery.JWKSURI, JWKSPath: *jwksPath, KeyIDs: []string{}}
+			for _, key := range jwks.Keys {
+				r.KeyIDs = append(r.KeyIDs, key.Kid)
+			}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// fetchJWKS reads the cluster's issuer and keys from the API server at
+// baseURL, returning the JWKS also as served.
+func fetchJWKS(client *http.Client, baseURL, bearer string) (*OpenIDConfiguration, *JWKS, []byte, error) {
+	discoveryBody, err := get(client, baseURL+"/.well-known/openid-configuration", bearer)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to fetch OpenID discovery document: %w", err)
+	}
+
+	var discovery OpenIDConfiguration
+	if err := json.Unmarshal(discoveryBody, &discovery); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse OpenID discovery document: %w", err)
+	}
+
+	// The advertised jwks_uri is often an address only reachable from
+	// outside the cluster, so read the keys from the API server directly.
+	jwksBody, err := get(client, baseURL+"/openid/v1/jwks", bearer)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	var jwks JWKS
+	if err := json.Unmarshal(jwksBody, &jwks); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, nil, nil, fmt.Errorf("cluster JWKS contains no keys")
+	}
+	return &discovery, &jwks, jwksBody, nil
+}
+
+func newClient(caPath string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if caPath != "" {
+		caPEM, err := os.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", caPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
+
+func get(client *http.Client, url, bearer string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
+}
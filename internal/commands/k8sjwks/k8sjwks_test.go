@@ -0,0 +1,117 @@
+package k8sjwks
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testIssuer = "https://container.googleapis.com/v1/projects/my-project/locations/us-central1/clusters/c"
+	testBearer = "admin-token"
+	testJWKS   = `{"keys":[{"use":"sig","kty":"RSA","kid":"key-1","alg":"RS256","n":"AQAB","e":"AQAB"}]}`
+)
+
+// fakeAPIServer serves the discovery document and JWKS of a cluster that
+// requires testBearer, with jwks as its keys.
+func fakeAPIServer(t *testing.T, jwks string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testBearer {
+			http.Error(w, `{"kind":"Status","message":"Unauthorized","code":401}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Write([]byte(`{"issuer":"` + testIssuer + `","jwks_uri":"https://10.0.0.1:443/openid/v1/jwks"}`))
+		case "/openid/v1/jwks":
+			w.Write([]byte(jwks))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchJWKS(t *testing.T) {
+	server := fakeAPIServer(t, testJWKS)
+
+	discovery, jwks, body, err := fetchJWKS(server.Client(), server.URL, testBearer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovery.Issuer != testIssuer || discovery.JWKSURI != "https://10.0.0.1:443/openid/v1/jwks" {
+		t.Errorf("discovery = %+v", discovery)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "key-1" || jwks.Keys[0].Alg != "RS256" {
+		t.Errorf("keys = %+v, want key-1", jwks.Keys)
+	}
+	if string(body) != testJWKS {
+		t.Errorf("JWKS body = %s, want it as served", body)
+	}
+}
+
+func TestFetchJWKSErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		jwks   string
+		bearer string
+		want   string
+	}{
+		{"no keys", `{"keys":[]}`, testBearer, "contains no keys"},
+		{"not JSON", `<html>`, testBearer, "failed to parse JWKS"},
+		{"unauthorized", testJWKS, "", "status 401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakeAPIServer(t, tt.jwks)
+			_, _, _, err := fetchJWKS(server.Client(), server.URL, tt.bearer)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("fetchJWKS() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientCAFile(t *testing.T) {
+	server := fakeAPIServer(t, testJWKS)
+	dir := t.TempDir()
+
+	caPath := filepath.Join(dir, "ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := newClient(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := fetchJWKS(client, server.URL, testBearer); err != nil {
+		t.Errorf("fetchJWKS() with the cluster CA: %v", err)
+	}
+
+	// Without the cluster CA the server's certificate isn't trusted.
+	client, err = newClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := fetchJWKS(client, server.URL, testBearer); err == nil {
+		t.Error("fetchJWKS() trusted the cluster without its CA")
+	}
+
+	notPEM := filepath.Join(dir, "not.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newClient(notPEM); err == nil {
+		t.Error("newClient() accepted a CA file without certificates")
+	}
+	if _, err := newClient(filepath.Join(dir, "missing.crt")); err == nil {
+		t.Error("newClient() accepted a missing CA file")
+	}
+}
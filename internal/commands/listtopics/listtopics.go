@@ -0,0 +1,272 @@
+// Package listtopics implements "wif pubsub topics list" (list-topics).
+package listtopics
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+	"wif-poc/internal/pubsub"
+)
+
+// Command lists the Pub/Sub topics of a project.
+var Command = &cli.Command{
+	Name:     "pubsub topics list",
+	Binary:   "list-topics",
+	Summary:  "List the Pub/Sub topics of a project",
+	Synopsis: []string{"--project-id <PROJECT_ID> --token-input <PATH> [options]"},
+	Notes:    []string{"All pages are fetched, whatever --page-size is."},
+	Examples: []string{
+		"--project-id my-project --token-input gcp_access_token.txt",
+		"--project-id my-project --token-input gcp_access_token.txt --filter-prefix orders- --print names",
+	},
+	Setup: setup,
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+// Topic is a Pub/Sub topic resource. Fields not modeled here are kept in
+// Raw so --print json and yaml show the full resource.
+type Topic struct {
+	Name                     string            `json:"name"`
+	Labels                   map[string]string `json:"labels"`
+	MessageRetentionDuration string            `json:"messageRetentionDuration"`
+	KMSKeyName               string            `json:"kmsKeyName"`
+
+	Raw map[string]interface{} `json:"-"`
+}
+
+func (t *Topic) UnmarshalJSON(data []byte) error {
+	type plain Topic
+	if err := json.Unmarshal(data, (*plain)(t)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &t.Raw)
+}
+
+// ID returns the topic ID, the last segment of its resource name.
+func (t *Topic) ID() string {
+	return t.Name[strings.LastIndex(t.Name, "/")+1:]
+}
+
+type PubSubTopicsResponse struct {
+	Topics        []Topic `json:"topics"`
+	NextPageToken string  `json:"nextPageToken"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	projectID := fs.String("project-id", "", "GCP project ID, not the project number (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file, - for stdin (required)")
+	pageSize := fs.Int("page-size", 0, "Topics requested per page (server default when 0)")
+	filterPrefix := fs.String("filter-prefix", "", "Only list topics whose ID starts with this prefix")
+	filterRegex := fs.String("filter-regex", "", "Only list topics whose ID matches this regular expression")
+	printFormat := fs.String("print", "", "Print only the result as json, yaml, table or names")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		if *projectID == "" || *tokenPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.Valid(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected %s)\n", *printFormat, strings.Join(output.Formats, ", "))
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		var nameFilter *regexp.Regexp
+		if *filterRegex != "" {
+			var err error
+			nameFilter, err = regexp.Compile(*filterRegex)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid --filter-regex: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with --print results.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		fmt.Fprintln(cli.Log, "=== Step 4: Listing Pub/Sub Topics ===")
+		fmt.Fprintln(cli.Log, "Using the access token to call GCP Pub/Sub API")
+		fmt.Fprintln(cli.Log)
+
+		// Load the access token
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		client := &pubsub.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("pubsub"),
+			AccessToken: accessToken,
+		}
+
+		// Call Pub/Sub API to list topics
+		topics, err := listPubSubTopics(client, *projectID, *pageSize)
+		if err != nil {
+			cli.PrintError(os.Stderr, fmt.Errorf("failed to list topics: %w", err))
+			os.Exit(1)
+		}
+		total := len(topics)
+		topics = filterTopics(topics, *filterPrefix, nameFilter)
+
+		if *printFormat != "" {
+			if err := printTopics(os.Stdout, *printFormat, topics); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Fprintln(cli.Log, "✓ Successfully called Pub/Sub API!")
+		fmt.Fprintln(cli.Log)
+
+		switch {
+		case total == 0:
+			fmt.Fprintln(cli.Log, "No topics found in project.")
+			fmt.Fprintln(cli.Log, "You can create a test topic with:")
+			fmt.Fprintf(cli.Log, "  gcloud pubsub topics create test-topic --project=%s\n", *projectID)
+		case len(topics) == 0:
+			fmt.Fprintf(cli.Log, "None of the %d topic(s) match the filter.\n", total)
+		default:
+			if len(topics) < total {
+				fmt.Fprintf(cli.Log, "Found %d topic(s), %d match the filter:\n", total, len(topics))
+			} else {
+				fmt.Fprintf(cli.Log, "Found %d topic(s):\n", total)
+			}
+			for i, topic := range topics {
+				fmt.Printf("  %d. %s\n", i+1, topic.Name)
+			}
+		}
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== SUCCESS ===")
+		fmt.Fprintln(cli.Log, "Workload Identity Federation is working correctly!")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "You've successfully:")
+		fmt.Fprintln(cli.Log, "  1. Created a JWT token from an external identity")
+		fmt.Fprintln(cli.Log, "  2. Exchanged it for a GCP federated token")
+		fmt.Fprintln(cli.Log, "  3. Exchanged the federated token for an access token")
+		fmt.Fprintln(cli.Log, "  4. Used the access token to call GCP APIs")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "The access token in gcp_access_token.txt can be used to call other GCP APIs.")
+		fmt.Fprintln(cli.Log, "To start over, run: ./bin/generate-keys")
+	}
+}
+
+// listPubSubTopics returns every topic in the project, following
+// nextPageToken until the last page.
+func listPubSubTopics(client *pubsub.Client, projectID string, pageSize int) ([]Topic, error) {
+	baseURL := client.URL("projects/"+projectID+"/topics", "")
+
+	fmt.Fprintf(cli.Log, "Calling Pub/Sub API:\n")
+	fmt.Fprintf(cli.Log, "  URL: %s\n", baseURL)
+	fmt.Fprintf(cli.Log, "  Method: GET\n")
+	fmt.Fprintf(cli.Log, "  Authorization: Bearer <access_token>\n")
+	fmt.Fprintln(cli.Log)
+
+	var topics []Topic
+	pageToken := ""
+	for page := 1; ; page++ {
+		query := url.Values{}
+		if pageSize > 0 {
+			query.Set("pageSize", strconv.Itoa(pageSize))
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		pageURL := baseURL
+		if len(query) > 0 {
+			pageURL += "?" + query.Encode()
+		}
+
+		var topicsResp PubSubTopicsResponse
+		if err := client.Call(context.Background(), "GET", pageURL, nil, &topicsResp); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topicsResp.Topics...)
+
+		if topicsResp.NextPageToken == "" {
+			if page > 1 {
+				fmt.Fprintf(cli.Log, "  Fetched %d pages\n\n", page)
+			}
+			return topics, nil
+		}
+		pageToken = topicsResp.NextPageToken
+	}
+}
+
+// filterTopics keeps the topics whose ID has the prefix and matches re,
+// when those are set.
+func filterTopics(topics []Topic, prefix string, re *regexp.Regexp) []Topic {
+	var kept []Topic
+	for _, topic := range topics {
+		if !strings.HasPrefix(topic.ID(), prefix) {
+			continue
+		}
+		if re != nil && !re.MatchString(topic.ID()) {
+			continue
+		}
+		kept = append(kept, topic)
+	}
+	return kept
+}
+
+func printTopics(w io.Writer, format string, topics []Topic) error {
+	switch format {
+	case "json", "yaml":
+		raw := make([]map[string]interface{}, 0, len(topics))
+		for _, topic := range topics {
+			raw = append(raw, topic.Raw)
+		}
+		if format == "json" {
+			return output.JSON(w, raw)
+		}
+		return output.YAML(w, raw)
+	case "table":
+		var rows [][]string
+		for _, topic := range topics {
+			rows = append(rows, []string{topic.ID(), orDash(cli.FormatKeyValues(topic.Labels)), orDash(topic.MessageRetentionDuration), orDash(topic.KMSKeyName)})
+		}
+		return output.Table(w, []string{"TOPIC", "LABELS", "RETENTION", "KMS KEY"}, rows)
+	default:
+		names := make([]string, 0, len(topics))
+		for _, topic := range topics {
+			names = append(names, topic.Name)
+		}
+		return output.Names(w, names)
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,269 @@
+// Package managesubscription implements "wif pubsub subscriptions
+// create|describe|delete" (manage-subscription).
+package managesubscription
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+	"wif-poc/internal/pubsub"
+)
+
+// Limits accepted by the API.
+const (
+	minAckDeadline          = 10 * time.Second
+	maxAckDeadline          = 10 * time.Minute
+	minRetention            = 10 * time.Minute
+	maxRetention            = 7 * 24 * time.Hour
+	minDeliveryAttempts     = 5
+	maxDeliveryAttempts     = 100
+	defaultDeliveryAttempts = 5
+)
+
+// Commands create, describe and delete Pub/Sub subscriptions.
+var Commands = []*cli.Command{command("create"), command("describe"), command("delete")}
+
+func command(action string) *cli.Command {
+	c := &cli.Command{
+		Name:     "pubsub subscriptions " + action,
+		Binary:   "manage-subscription " + action,
+		Summary:  map[string]string{"create": "Create a pull or push Pub/Sub subscription", "describe": "Show a Pub/Sub subscription", "delete": "Delete a Pub/Sub subscription"}[action],
+		Synopsis: []string{"--project-id <PROJECT_ID> --subscription <SUBSCRIPTION> --token-input <PATH> [options]"},
+		Examples: []string{"--project-id my-project --subscription wif-test-sub --token-input gcp_access_token.txt"},
+		Setup:    func(fs *flag.FlagSet) func() { return setup(fs, action) },
+	}
+	if action == "create" {
+		c.Synopsis = []string{"--project-id <PROJECT_ID> --subscription <SUBSCRIPTION> --topic <TOPIC> --token-input <PATH> [options]"}
+		c.Examples = []string{
+			"--project-id my-project --subscription wif-test-sub --topic wif-test --token-input gcp_access_token.txt --ack-deadline 60s --dead-letter-topic wif-test-dlq",
+			"--project-id my-project --subscription wif-push --topic wif-test --token-input gcp_access_token.txt --push-endpoint https://my-service.run.app/push --push-service-account pusher@my-project.iam.gserviceaccount.com",
+		}
+	}
+	return c
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+func setup(fs *flag.FlagSet, action string) func() {
+	projectID := fs.String("project-id", "", "GCP project ID (required unless names are full resource names)")
+	subscription := fs.String("subscription", "", "Subscription ID or projects/PROJECT/subscriptions/SUBSCRIPTION (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file, - for stdin (required unless PUBSUB_EMULATOR_HOST is set)")
+	opts := subscriptionOptions{Labels: cli.KeyValues{}}
+	if action == "create" {
+		fs.StringVar(&opts.Topic, "topic", "", "Topic ID or full name to subscribe to (required)")
+		fs.StringVar(&opts.PushEndpoint, "push-endpoint", "", "Push messages to this HTTPS URL instead of waiting for pulls")
+		fs.StringVar(&opts.PushServiceAccount, "push-service-account", "", "Service account whose OIDC token authenticates push requests")
+		fs.StringVar(&opts.PushAudience, "push-audience", "", "Audience of the push OIDC token (defaults to the endpoint)")
+		fs.DurationVar(&opts.AckDeadline, "ack-deadline", 0, "Ack deadline, 10s to 10m")
+		fs.DurationVar(&opts.Retention, "message-retention", 0, "Retain unacknowledged messages this long, 10m to 7 days")
+		fs.BoolVar(&opts.RetainAcked, "retain-acked", false, "Also retain acknowledged messages, for seeking back")
+		fs.StringVar(&opts.DeadLetterTopic, "dead-letter-topic", "", "Topic ID or full name receiving undeliverable messages")
+		fs.IntVar(&opts.MaxDeliveryAttempts, "max-delivery-attempts", defaultDeliveryAttempts, "Delivery attempts before dead-lettering, 5 to 100")
+		fs.StringVar(&opts.Filter, "filter", "", "Only deliver messages matching this filter, e.g. attributes.source=\"wif\"")
+		fs.BoolVar(&opts.Ordering, "enable-ordering", false, "Deliver messages with the same ordering key in order")
+		fs.Var(cli.KeyValues(opts.Labels), "label", "Label as key=value, repeatable")
+	}
+	printFormat := fs.String("print", "", "Print only the resource as json, yaml, table or names")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		emulator := netConfig.PubSubEmulatorHost != ""
+		missingProject := *projectID == "" && (!strings.HasPrefix(*subscription, "projects/") ||
+			(action == "create" && !strings.HasPrefix(opts.Topic, "projects/")) ||
+			(opts.DeadLetterTopic != "" && !strings.HasPrefix(opts.DeadLetterTopic, "projects/")))
+		if *subscription == "" || (action == "create" && opts.Topic == "") || missingProject || (*tokenPath == "" && !emulator) {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.Valid(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected %s)\n", *printFormat, strings.Join(output.Formats, ", "))
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		var body map[string]interface{}
+		if action == "create" {
+			var err error
+			opts.Topic = pubsub.TopicName(*projectID, opts.Topic)
+			body, err = subscriptionBody(opts, *projectID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with --print results.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		client := &pubsub.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("pubsub"),
+			AccessToken: accessToken,
+		}
+		subscriptionName := pubsub.SubscriptionName(*projectID, *subscription)
+		ctx := context.Background()
+
+		method := map[string]string{"create": "PUT", "describe": "GET", "delete": "DELETE"}[action]
+		fmt.Fprintf(cli.Log, "=== Pub/Sub Subscription: %s ===\n", action)
+		fmt.Fprintln(cli.Log, "Using the access token to manage the subscription with the service account's identity")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Calling Pub/Sub API:")
+		fmt.Fprintf(cli.Log, "  URL: %s\n", client.URL(subscriptionName, ""))
+		fmt.Fprintf(cli.Log, "  Method: %s\n", method)
+		fmt.Fprintln(cli.Log)
+
+		var resource map[string]interface{}
+		switch action {
+		case "create":
+			resource, err = client.Create(ctx, subscriptionName, body)
+		case "describe":
+			resource, err = client.Get(ctx, subscriptionName)
+		case "delete":
+			err = client.Delete(ctx, subscriptionName)
+			resource = map[string]interface{}{"name": subscriptionName, "deleted": true}
+		}
+		if err != nil {
+			cli.PrintError(os.Stderr, fmt.Errorf("failed to %s subscription: %w", action, err))
+			os.Exit(1)
+		}
+
+		if *printFormat != "" {
+			if err := output.Resource(os.Stdout, *printFormat, resource); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		switch action {
+		case "create":
+			fmt.Fprintf(cli.Log, "✓ Created subscription %s\n", subscriptionName)
+		case "describe":
+			fmt.Fprintf(cli.Log, "✓ Subscription %s\n", subscriptionName)
+		case "delete":
+			fmt.Fprintf(cli.Log, "✓ Deleted subscription %s\n", subscriptionName)
+			return
+		}
+		fmt.Fprintln(cli.Log)
+		output.Fields(os.Stdout, resource)
+
+		if action == "create" && opts.DeadLetterTopic != "" {
+			fmt.Fprintln(cli.Log)
+			fmt.Fprintln(cli.Log, "Dead-lettering needs the Pub/Sub service agent (service-PROJECT_NUMBER@gcp-sa-pubsub.iam.gserviceaccount.com)")
+			fmt.Fprintln(cli.Log, "to have roles/pubsub.publisher on the dead-letter topic and roles/pubsub.subscriber on this subscription.")
+		}
+		pushConfig, _ := resource["pushConfig"].(map[string]interface{})
+		if _, push := pushConfig["pushEndpoint"]; !push {
+			fmt.Fprintln(cli.Log)
+			fmt.Fprintln(cli.Log, "=== Next Step ===")
+			fmt.Fprintln(cli.Log, "Pull messages from the subscription:")
+			fmt.Fprintln(cli.Log)
+			fmt.Fprintf(cli.Log, "  ./bin/pull-messages --subscription %s --token-input <PATH>\n", subscriptionName)
+		}
+	}
+}
+
+// subscriptionOptions are the create flags.
+type subscriptionOptions struct {
+	Topic               string
+	PushEndpoint        string
+	PushServiceAccount  string
+	PushAudience        string
+	AckDeadline         time.Duration
+	Retention           time.Duration
+	RetainAcked         bool
+	DeadLetterTopic     string
+	MaxDeliveryAttempts int
+	Filter              string
+	Ordering            bool
+	Labels              map[string]string
+}
+
+// subscriptionBody validates the create flags and builds the Subscription
+// resource to send.
+func subscriptionBody(o subscriptionOptions, projectID string) (map[string]interface{}, error) {
+	body := map[string]interface{}{"topic": o.Topic}
+
+	if o.PushEndpoint != "" {
+		pushConfig := map[string]interface{}{"pushEndpoint": o.PushEndpoint}
+		if o.PushServiceAccount != "" {
+			oidc := map[string]string{"serviceAccountEmail": o.PushServiceAccount}
+			if o.PushAudience != "" {
+				oidc["audience"] = o.PushAudience
+			}
+			pushConfig["oidcToken"] = oidc
+		} else if o.PushAudience != "" {
+			return nil, fmt.Errorf("--push-audience needs --push-service-account")
+		}
+		body["pushConfig"] = pushConfig
+	} else if o.PushServiceAccount != "" || o.PushAudience != "" {
+		return nil, fmt.Errorf("--push-service-account and --push-audience need --push-endpoint")
+	}
+
+	if o.AckDeadline != 0 {
+		if o.AckDeadline < minAckDeadline || o.AckDeadline > maxAckDeadline {
+			return nil, fmt.Errorf("--ack-deadline must be between %s and %s", minAckDeadline, maxAckDeadline)
+		}
+		body["ackDeadlineSeconds"] = int(o.AckDeadline / time.Second)
+	}
+	if o.Retention != 0 {
+		if o.Retention < minRetention || o.Retention > maxRetention {
+			return nil, fmt.Errorf("--message-retention must be between %s and %s", minRetention, maxRetention)
+		}
+		body["messageRetentionDuration"] = pubsub.Duration(o.Retention)
+	}
+	if o.RetainAcked {
+		body["retainAckedMessages"] = true
+	}
+
+	if o.DeadLetterTopic != "" {
+		if o.MaxDeliveryAttempts < minDeliveryAttempts || o.MaxDeliveryAttempts > maxDeliveryAttempts {
+			return nil, fmt.Errorf("--max-delivery-attempts must be between %d and %d", minDeliveryAttempts, maxDeliveryAttempts)
+		}
+		body["deadLetterPolicy"] = map[string]interface{}{
+			"deadLetterTopic":     pubsub.TopicName(projectID, o.DeadLetterTopic),
+			"maxDeliveryAttempts": o.MaxDeliveryAttempts,
+		}
+	} else if o.MaxDeliveryAttempts != defaultDeliveryAttempts {
+		return nil, fmt.Errorf("--max-delivery-attempts needs --dead-letter-topic")
+	}
+
+	if o.Filter != "" {
+		body["filter"] = o.Filter
+	}
+	if o.Ordering {
+		body["enableMessageOrdering"] = true
+	}
+	if len(o.Labels) > 0 {
+		body["labels"] = o.Labels
+	}
+	return body, nil
+}
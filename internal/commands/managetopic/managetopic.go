@@ -0,0 +1,169 @@
+// Package managetopic implements "wif pubsub topics create|describe|delete"
+// (manage-topic).
+package managetopic
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+	"wif-poc/internal/pubsub"
+)
+
+// Message retention bounds accepted by the API.
+const (
+	minRetention = 10 * time.Minute
+	maxRetention = 31 * 24 * time.Hour
+)
+
+// Commands create, describe and delete Pub/Sub topics.
+var Commands = []*cli.Command{command("create"), command("describe"), command("delete")}
+
+func command(action string) *cli.Command {
+	c := &cli.Command{
+		Name:     "pubsub topics " + action,
+		Binary:   "manage-topic " + action,
+		Summary:  map[string]string{"create": "Create a Pub/Sub topic", "describe": "Show a Pub/Sub topic", "delete": "Delete a Pub/Sub topic"}[action],
+		Synopsis: []string{"--project-id <PROJECT_ID> --topic <TOPIC> --token-input <PATH> [options]"},
+		Examples: []string{"--project-id my-project --topic wif-test --token-input gcp_access_token.txt"},
+		Setup:    func(fs *flag.FlagSet) func() { return setup(fs, action) },
+	}
+	if action == "create" {
+		c.Examples = []string{"--project-id my-project --topic wif-test --token-input gcp_access_token.txt --label team=platform --message-retention 24h"}
+	}
+	return c
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+func setup(fs *flag.FlagSet, action string) func() {
+	projectID := fs.String("project-id", "", "GCP project ID (required unless --topic is a full resource name)")
+	topic := fs.String("topic", "", "Topic ID or projects/PROJECT/topics/TOPIC (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file, - for stdin (required unless PUBSUB_EMULATOR_HOST is set)")
+	labels := cli.KeyValues{}
+	var retention time.Duration
+	var kmsKey string
+	if action == "create" {
+		fs.Var(labels, "label", "Label as key=value, repeatable")
+		fs.DurationVar(&retention, "message-retention", 0, "Retain published messages this long, 10m to 31 days")
+		fs.StringVar(&kmsKey, "kms-key", "", "Cloud KMS key protecting the topic's messages, projects/P/locations/L/keyRings/R/cryptoKeys/K")
+	}
+	printFormat := fs.String("print", "", "Print only the resource as json, yaml, table or names")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		emulator := netConfig.PubSubEmulatorHost != ""
+		missingProject := *projectID == "" && !strings.HasPrefix(*topic, "projects/")
+		if *topic == "" || missingProject || (*tokenPath == "" && !emulator) {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.Valid(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected %s)\n", *printFormat, strings.Join(output.Formats, ", "))
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+		if retention != 0 && (retention < minRetention || retention > maxRetention) {
+			fmt.Fprintf(os.Stderr, "Error: --message-retention must be between %s and %s\n", minRetention, maxRetention)
+			os.Exit(1)
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with --print results.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		client := &pubsub.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("pubsub"),
+			AccessToken: accessToken,
+		}
+		topicName := pubsub.TopicName(*projectID, *topic)
+		ctx := context.Background()
+
+		method := map[string]string{"create": "PUT", "describe": "GET", "delete": "DELETE"}[action]
+		fmt.Fprintf(cli.Log, "=== Pub/Sub Topic: %s ===\n", action)
+		fmt.Fprintln(cli.Log, "Using the access token to manage the topic with the service account's identity")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Calling Pub/Sub API:")
+		fmt.Fprintf(cli.Log, "  URL: %s\n", client.URL(topicName, ""))
+		fmt.Fprintf(cli.Log, "  Method: %s\n", method)
+		fmt.Fprintln(cli.Log)
+
+		var resource map[string]interface{}
+		switch action {
+		case "create":
+			body := map[string]interface{}{}
+			if len(labels) > 0 {
+				body["labels"] = labels
+			}
+			if retention > 0 {
+				body["messageRetentionDuration"] = pubsub.Duration(retention)
+			}
+			if kmsKey != "" {
+				body["kmsKeyName"] = kmsKey
+			}
+			resource, err = client.Create(ctx, topicName, body)
+		case "describe":
+			resource, err = client.Get(ctx, topicName)
+		case "delete":
+			err = client.Delete(ctx, topicName)
+			resource = map[string]interface{}{"name": topicName, "deleted": true}
+		}
+		if err != nil {
+			cli.PrintError(os.Stderr, fmt.Errorf("failed to %s topic: %w", action, err))
+			os.Exit(1)
+		}
+
+		if *printFormat != "" {
+			if err := output.Resource(os.Stdout, *printFormat, resource); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		switch action {
+		case "create":
+			fmt.Fprintf(cli.Log, "✓ Created topic %s\n", topicName)
+		case "describe":
+			fmt.Fprintf(cli.Log, "✓ Topic %s\n", topicName)
+		case "delete":
+			fmt.Fprintf(cli.Log, "✓ Deleted topic %s\n", topicName)
+			fmt.Fprintln(cli.Log, "Subscriptions to it remain, attached to _deleted-topic_, until deleted with manage-subscription.")
+			return
+		}
+		fmt.Fprintln(cli.Log)
+		output.Fields(os.Stdout, resource)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Create a subscription to the topic:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintf(cli.Log, "  ./bin/manage-subscription create --topic %s --subscription <SUBSCRIPTION> --token-input <PATH>\n", topicName)
+	}
+}
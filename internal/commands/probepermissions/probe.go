@@ -0,0 +1,147 @@
+package probepermissions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxPermissionsPerCall is the most permissions testIamPermissions accepts
+// in one request.
+const maxPermissionsPerCall = 100
+
+// resource is something testIamPermissions can be called on.
+type resource struct {
+	Kind string // project, topic, subscription or serviceAccount
+	Name string // full resource name
+}
+
+// parseResource accepts a full resource name, or a bare service account
+// email.
+func parseResource(value string) (resource, error) {
+	parts := strings.Split(value, "/")
+	switch {
+	case !strings.Contains(value, "/") && strings.Contains(value, "@"):
+		return resource{Kind: "serviceAccount", Name: "projects/-/serviceAccounts/" + value}, nil
+	case len(parts) == 2 && parts[0] == "projects":
+		return resource{Kind: "project", Name: value}, nil
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "topics":
+		return resource{Kind: "topic", Name: value}, nil
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "subscriptions":
+		return resource{Kind: "subscription", Name: value}, nil
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "serviceAccounts":
+		return resource{Kind: "serviceAccount", Name: value}, nil
+	}
+	return resource{}, fmt.Errorf("unsupported resource %q (expected projects/P, projects/P/topics/T, projects/P/subscriptions/S or a service account email)", value)
+}
+
+// Label is the short column heading for the resource.
+func (r resource) Label() string {
+	return r.Kind + ":" + r.Name[strings.LastIndex(r.Name, "/")+1:]
+}
+
+// applies reports whether permission can be tested on the resource; the
+// API rejects the whole request when any permission doesn't apply.
+func (r resource) applies(permission string) bool {
+	switch r.Kind {
+	case "topic":
+		return strings.HasPrefix(permission, "pubsub.topics.")
+	case "subscription":
+		return strings.HasPrefix(permission, "pubsub.subscriptions.")
+	case "serviceAccount":
+		return strings.HasPrefix(permission, "iam.serviceAccounts.")
+	default:
+		return true
+	}
+}
+
+// endpoint returns the testIamPermissions URL and the API name for errors.
+func (r resource) endpoint() (string, string) {
+	switch r.Kind {
+	case "topic", "subscription":
+		return netConfig.ServiceURL("pubsub") + "/v1/" + r.Name + ":testIamPermissions", "Pub/Sub"
+	case "serviceAccount":
+		return netConfig.ServiceURL("iam") + "/v1/" + r.Name + ":testIamPermissions", "IAM"
+	default:
+		return netConfig.ServiceURL("cloudresourcemanager") + "/v1/" + r.Name + ":testIamPermissions", "Resource Manager"
+	}
+}
+
+// probeResult is the outcome for one resource.
+type probeResult struct {
+	Resource      string   `json:"resource"`
+	Granted       []string `json:"granted"`
+	Denied        []string `json:"denied"`
+	NotApplicable []string `json:"notApplicable,omitempty"`
+}
+
+// probe tests the permissions that apply to r, in chunks the API accepts.
+func probe(ctx context.Context, accessToken string, r resource, permissions []string) (*probeResult, error) {
+	result := &probeResult{Resource: r.Name, Granted: []string{}, Denied: []string{}}
+
+	var applicable []string
+	for _, p := range permissions {
+		if r.applies(p) {
+			applicable = append(applicable, p)
+		} else {
+			result.NotApplicable = append(result.NotApplicable, p)
+		}
+	}
+
+	granted := map[string]bool{}
+	for start := 0; start < len(applicable); start += maxPermissionsPerCall {
+		chunk := applicable[start:min(start+maxPermissionsPerCall, len(applicable))]
+		var resp struct {
+			Permissions []string `json:"permissions"`
+		}
+		url, api := r.endpoint()
+		if err := httpClient.CallJSON(ctx, api, "POST", url, accessToken, map[string]interface{}{"permissions": chunk}, &resp); err != nil {
+			return nil, err
+		}
+		for _, p := range resp.Permissions {
+			granted[p] = true
+		}
+	}
+
+	for _, p := range applicable {
+		if granted[p] {
+			result.Granted = append(result.Granted, p)
+		} else {
+			result.Denied = append(result.Denied, p)
+		}
+	}
+	return result, nil
+}
+
+// rolePermissions returns the permissions included in a predefined
+// (roles/...) or custom (projects/.../roles/...) role.
+func rolePermissions(ctx context.Context, accessToken, role string) ([]string, error) {
+	if !strings.Contains(role, "/") {
+		role = "roles/" + role
+	}
+	var resp struct {
+		IncludedPermissions []string `json:"includedPermissions"`
+	}
+	if err := httpClient.CallJSON(ctx, "IAM", "GET", netConfig.ServiceURL("iam")+"/v1/"+role, accessToken, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.IncludedPermissions) == 0 {
+		return nil, fmt.Errorf("role %s includes no permissions", role)
+	}
+	return resp.IncludedPermissions, nil
+}
+
+// uniqueSorted returns the distinct values in order.
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
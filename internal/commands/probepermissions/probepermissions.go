@@ -0,0 +1,216 @@
+// Package probepermissions implements "wif permissions probe"
+// (probe-permissions).
+package probepermissions
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+)
+
+// Command reports which permissions the token's identity holds on
+// resources.
+var Command = &cli.Command{
+	Name:     "permissions probe",
+	Binary:   "probe-permissions",
+	Summary:  "Show which IAM permissions the token's identity has on projects, topics, subscriptions and service accounts",
+	Synopsis: []string{"--token-input <PATH> --resource <RESOURCE> (--permission <PERMISSION> | --role <ROLE>) [options]"},
+	Notes: []string{
+		"--resource is projects/PROJECT_ID, projects/PROJECT_ID/topics/TOPIC,\n" +
+			"projects/PROJECT_ID/subscriptions/SUBSCRIPTION or a service account email.",
+		"Topics, subscriptions and service accounts are only tested for their own permissions\n" +
+			"(pubsub.topics.*, pubsub.subscriptions.*, iam.serviceAccounts.*); others show as not applicable.",
+	},
+	Examples: []string{
+		"--token-input gcp_access_token.txt --resource projects/my-project --resource projects/my-project/topics/wif-test --role roles/pubsub.publisher",
+		"--token-input gcp_access_token.txt --resource projects/my-project --permission pubsub.topics.list,pubsub.topics.create --fail-on-denied",
+	},
+	Setup: setup,
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+func setup(fs *flag.FlagSet) func() {
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file from exchange-token, - for stdin (required)")
+	var resourceNames, permissionValues, roles []string
+	fs.Func("resource", "Resource to probe, repeatable: projects/P, projects/P/topics/T, projects/P/subscriptions/S or a service account email", func(v string) error {
+		resourceNames = append(resourceNames, v)
+		return nil
+	})
+	fs.Func("permission", "Permission to test, repeatable or comma-separated", func(v string) error {
+		permissionValues = append(permissionValues, strings.Split(v, ",")...)
+		return nil
+	})
+	fs.Func("role", "Test every permission of a role (roles/NAME or projects/P/roles/NAME), repeatable", func(v string) error {
+		roles = append(roles, v)
+		return nil
+	})
+	failOnDenied := fs.Bool("fail-on-denied", false, "Exit with status 2 when any applicable permission is denied")
+	printFormat := fs.String("print", "", "Print only the result as json, yaml, table or names (denied permissions), for scripts")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		if *tokenPath == "" || len(resourceNames) == 0 || (len(permissionValues) == 0 && len(roles) == 0) {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.Valid(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected %s)\n", *printFormat, strings.Join(output.Formats, ", "))
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		var resources []resource
+		for _, name := range resourceNames {
+			r, err := parseResource(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			resources = append(resources, r)
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with --print results.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+		ctx := context.Background()
+
+		fmt.Fprintln(cli.Log, "=== Probing IAM Permissions ===")
+		fmt.Fprintln(cli.Log, "Asking each resource which of the permissions the token's identity holds (testIamPermissions)")
+		fmt.Fprintln(cli.Log)
+
+		permissions := permissionValues
+		for _, role := range roles {
+			fmt.Fprintf(cli.Log, "Expanding role %s...\n", role)
+			included, err := rolePermissions(ctx, accessToken, role)
+			if err != nil {
+				cli.PrintError(os.Stderr, fmt.Errorf("failed to get permissions of %s: %w", role, err))
+				os.Exit(1)
+			}
+			fmt.Fprintf(cli.Log, "  %d permission(s)\n", len(included))
+			permissions = append(permissions, included...)
+		}
+		permissions = uniqueSorted(permissions)
+		if len(roles) > 0 {
+			fmt.Fprintln(cli.Log)
+		}
+
+		var results []*probeResult
+		for _, r := range resources {
+			url, _ := r.endpoint()
+			fmt.Fprintf(cli.Log, "Testing %s\n", r.Name)
+			fmt.Fprintf(cli.Log, "  URL: %s\n", url)
+			result, err := probe(ctx, accessToken, r, permissions)
+			if err != nil {
+				cli.PrintError(os.Stderr, fmt.Errorf("failed to test permissions on %s: %w", r.Name, err))
+				os.Exit(1)
+			}
+			fmt.Fprintf(cli.Log, "  ✓ %d granted, %d denied, %d not applicable\n", len(result.Granted), len(result.Denied), len(result.NotApplicable))
+			results = append(results, result)
+		}
+		fmt.Fprintln(cli.Log)
+
+		denied := deniedPermissions(results)
+
+		switch *printFormat {
+		case "":
+			printMatrix(os.Stdout, resources, results, permissions)
+			fmt.Println()
+			fmt.Println("✓ granted  ✗ denied  - not applicable to the resource type")
+			if len(denied) > 0 {
+				fmt.Fprintln(cli.Log)
+				fmt.Fprintln(cli.Log, "=== Next Step ===")
+				fmt.Fprintln(cli.Log, "Grant a role that includes the denied permissions to the service account, e.g.:")
+				fmt.Fprintln(cli.Log)
+				fmt.Fprintln(cli.Log, "  gcloud projects add-iam-policy-binding <PROJECT_ID> --role=<ROLE> --member=\"serviceAccount:<SERVICE_ACCOUNT_EMAIL>\"")
+				fmt.Fprintln(cli.Log)
+				fmt.Fprintln(cli.Log, "Check which permissions a role includes before granting it:")
+				fmt.Fprintln(cli.Log)
+				fmt.Fprintln(cli.Log, "  gcloud iam roles describe <ROLE>")
+			}
+		case "table":
+			err = printMatrix(os.Stdout, resources, results, permissions)
+		case "names":
+			err = output.Names(os.Stdout, denied)
+		case "json":
+			err = output.JSON(os.Stdout, results)
+		case "yaml":
+			err = output.YAML(os.Stdout, results)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *failOnDenied && len(denied) > 0 {
+			os.Exit(2)
+		}
+	}
+}
+
+// printMatrix writes one row per permission and one column per resource.
+func printMatrix(w io.Writer, resources []resource, results []*probeResult, permissions []string) error {
+	header := []string{"PERMISSION"}
+	for _, r := range resources {
+		header = append(header, r.Label())
+	}
+
+	rows := make([][]string, 0, len(permissions))
+	for _, p := range permissions {
+		row := []string{p}
+		for _, result := range results {
+			row = append(row, mark(result, p))
+		}
+		rows = append(rows, row)
+	}
+	return output.Table(w, header, rows)
+}
+
+func mark(result *probeResult, permission string) string {
+	for _, p := range result.Granted {
+		if p == permission {
+			return "✓"
+		}
+	}
+	for _, p := range result.Denied {
+		if p == permission {
+			return "✗"
+		}
+	}
+	return "-"
+}
+
+// deniedPermissions returns the permissions denied on at least one resource.
+func deniedPermissions(results []*probeResult) []string {
+	var denied []string
+	for _, result := range results {
+		denied = append(denied, result.Denied...)
+	}
+	return uniqueSorted(denied)
+}
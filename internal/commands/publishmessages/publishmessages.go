@@ -0,0 +1,240 @@
+// Package publishmessages implements "wif pubsub publish" (publish-messages).
+package publishmessages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+	"wif-poc/internal/pubsub"
+)
+
+// Command publishes messages to a Pub/Sub topic.
+var Command = &cli.Command{
+	Name:     "pubsub publish",
+	Binary:   "publish-messages",
+	Summary:  "Publish messages to a Pub/Sub topic",
+	Synopsis: []string{"--project-id <PROJECT_ID> --topic <TOPIC> --token-input <PATH> [--message <TEXT> | --input <PATH>] [options]"},
+	Notes: []string{
+		"Without --message the data is read from --input, stdin by default, so messages\n" +
+			"can be piped in: cat events.txt | ... --split-lines",
+	},
+	Examples: []string{
+		"--project-id my-project --topic test-topic --token-input gcp_access_token.txt --message 'hello' --attribute source=wif",
+		"--project-id my-project --topic test-topic --token-input gcp_access_token.txt --input events.txt --split-lines",
+	},
+	Setup: setup,
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+type publishResult struct {
+	Topic      string   `json:"topic"`
+	MessageIDs []string `json:"messageIds"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	projectID := fs.String("project-id", "", "GCP project ID (required unless --topic is a full resource name)")
+	topic := fs.String("topic", "", "Topic ID or projects/PROJECT/topics/TOPIC (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file, - for stdin (required unless PUBSUB_EMULATOR_HOST is set)")
+	message := fs.String("message", "", "Message data (otherwise read from --input)")
+	inputPath := fs.String("input", "-", "File with the message data, - for stdin")
+	splitLines := fs.Bool("split-lines", false, "Publish each non-empty input line as its own message")
+	attributes := cli.KeyValues{}
+	fs.Var(attributes, "attribute", "Message attribute as key=value, repeatable")
+	orderingKey := fs.String("ordering-key", "", "Ordering key for all messages (the subscription must enable ordering)")
+	batchSize := fs.Int("batch-size", 100, "Messages per publish request (at most 1000)")
+	printFormat := fs.String("print", "", "Print only the message IDs as json, yaml, table or names")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		emulator := netConfig.PubSubEmulatorHost != ""
+		missingProject := *projectID == "" && !strings.HasPrefix(*topic, "projects/")
+		if *topic == "" || missingProject || (*tokenPath == "" && !emulator) {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.Valid(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected %s)\n", *printFormat, strings.Join(output.Formats, ", "))
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+		if *batchSize < 1 || *batchSize > pubsub.MaxBatchMessages {
+			fmt.Fprintf(os.Stderr, "Error: --batch-size must be between 1 and %d\n", pubsub.MaxBatchMessages)
+			os.Exit(1)
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with --print results.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		payloads, err := readPayloads(*message, *inputPath, *splitLines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading message data: %v\n", err)
+			os.Exit(1)
+		}
+
+		var messages []pubsub.Message
+		for _, data := range payloads {
+			if len(data) == 0 && len(attributes) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: a message needs data or at least one --attribute")
+				os.Exit(1)
+			}
+			messages = append(messages, pubsub.Message{
+				Data:        data,
+				Attributes:  attributes,
+				OrderingKey: *orderingKey,
+			})
+		}
+
+		client := &pubsub.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("pubsub"),
+			AccessToken: accessToken,
+		}
+		topicName := pubsub.TopicName(*projectID, *topic)
+
+		fmt.Fprintln(cli.Log, "=== Publishing Pub/Sub Messages ===")
+		fmt.Fprintln(cli.Log, "Using the access token to publish with the service account's identity")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Calling Pub/Sub API:")
+		fmt.Fprintf(cli.Log, "  URL: %s\n", client.URL(topicName, ":publish"))
+		fmt.Fprintf(cli.Log, "  Method: POST\n")
+		if emulator {
+			fmt.Fprintf(cli.Log, "  Emulator: %s\n", netConfig.PubSubEmulatorHost)
+		}
+		fmt.Fprintf(cli.Log, "  Messages: %d\n", len(messages))
+		fmt.Fprintln(cli.Log)
+
+		result := publishResult{Topic: topicName}
+		batches := batchMessages(messages, *batchSize)
+		for i, batch := range batches {
+			ids, err := client.Publish(context.Background(), topicName, batch)
+			if err != nil {
+				cli.PrintError(os.Stderr, fmt.Errorf("failed to publish batch %d of %d: %w", i+1, len(batches), err))
+				if len(result.MessageIDs) > 0 {
+					fmt.Fprintf(os.Stderr, "%d message(s) were published before the failure.\n", len(result.MessageIDs))
+				}
+				os.Exit(1)
+			}
+			result.MessageIDs = append(result.MessageIDs, ids...)
+			if len(batches) > 1 {
+				fmt.Fprintf(cli.Log, "  Batch %d/%d: %d message(s)\n", i+1, len(batches), len(ids))
+			}
+		}
+
+		if *printFormat != "" {
+			if err := printResult(os.Stdout, *printFormat, result); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Fprintf(cli.Log, "✓ Published %d message(s) to %s\n", len(result.MessageIDs), topicName)
+		for _, id := range result.MessageIDs {
+			fmt.Printf("  Message ID: %s\n", id)
+		}
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "=== Next Step ===")
+		fmt.Fprintln(cli.Log, "Pull the messages from a subscription to the topic:")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "  ./bin/pull-messages --project-id <PROJECT_ID> --subscription <SUBSCRIPTION> --token-input <PATH>")
+	}
+}
+
+// readPayloads returns the message data: --message, or the input file or
+// stdin, optionally split into one message per non-empty line.
+func readPayloads(message, inputPath string, splitLines bool) ([][]byte, error) {
+	var data []byte
+	if message != "" {
+		data = []byte(message)
+	} else {
+		var err error
+		if data, err = cli.ReadFile(inputPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if !splitLines {
+		return [][]byte{data}, nil
+	}
+
+	var payloads [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > 0 {
+			payloads = append(payloads, line)
+		}
+	}
+	if len(payloads) == 0 {
+		return nil, errors.New("no non-empty lines in input")
+	}
+	return payloads, nil
+}
+
+// batchMessages splits messages into publish requests of at most size
+// messages and pubsub.MaxBatchBytes as encoded on the wire.
+func batchMessages(messages []pubsub.Message, size int) [][]pubsub.Message {
+	var batches [][]pubsub.Message
+	var batch []pubsub.Message
+	batchBytes := 0
+	for _, m := range messages {
+		n := m.EncodedSize()
+		if len(batch) > 0 && (len(batch) == size || batchBytes+n > pubsub.MaxBatchBytes) {
+			batches = append(batches, batch)
+			batch, batchBytes = nil, 0
+		}
+		batch = append(batch, m)
+		batchBytes += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func printResult(w io.Writer, format string, result publishResult) error {
+	switch format {
+	case "json":
+		return output.JSON(w, result)
+	case "yaml":
+		return output.YAML(w, result)
+	case "table":
+		var rows [][]string
+		for i, id := range result.MessageIDs {
+			rows = append(rows, []string{strconv.Itoa(i + 1), id})
+		}
+		return output.Table(w, []string{"#", "MESSAGE ID"}, rows)
+	default:
+		return output.Names(w, result.MessageIDs)
+	}
+}
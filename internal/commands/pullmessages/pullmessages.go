@@ -0,0 +1,332 @@
+// Package pullmessages implements "wif pubsub pull" (pull-messages).
+package pullmessages
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/output"
+	"wif-poc/internal/pubsub"
+)
+
+// emptyPullDelay is how long to wait after a pull returns no messages
+// before pulling again while streaming.
+const emptyPullDelay = time.Second
+
+// defaultPendingAckDeadline is the ack deadline renewed for messages that
+// wait to be printed with --print, when --ack-deadline isn't given.
+const defaultPendingAckDeadline = time.Minute
+
+// Command pulls messages from a Pub/Sub subscription.
+var Command = &cli.Command{
+	Name:     "pubsub pull",
+	Binary:   "pull-messages",
+	Summary:  "Pull and acknowledge messages from a Pub/Sub subscription",
+	Synopsis: []string{"--project-id <PROJECT_ID> --subscription <SUBSCRIPTION> --token-input <PATH> [options]"},
+	Examples: []string{
+		"--project-id my-project --subscription test-sub --token-input gcp_access_token.txt --count 5 --wait 30s",
+	},
+	Setup: setup,
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+// pulledMessage is how a received message is shown: data as text when it's
+// valid UTF-8, base64 otherwise.
+type pulledMessage struct {
+	MessageID       string            `json:"messageId"`
+	PublishTime     string            `json:"publishTime,omitempty"`
+	OrderingKey     string            `json:"orderingKey,omitempty"`
+	Attributes      map[string]string `json:"attributes,omitempty"`
+	Data            string            `json:"data,omitempty"`
+	DataBase64      string            `json:"dataBase64,omitempty"`
+	DeliveryAttempt int               `json:"deliveryAttempt,omitempty"`
+}
+
+func setup(fs *flag.FlagSet) func() {
+	projectID := fs.String("project-id", "", "GCP project ID (required unless --subscription is a full resource name)")
+	subscription := fs.String("subscription", "", "Subscription ID or projects/PROJECT/subscriptions/SUBSCRIPTION (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file, - for stdin (required unless PUBSUB_EMULATOR_HOST is set)")
+	maxMessages := fs.Int("max-messages", 10, "Messages requested per pull")
+	count := fs.Int("count", 0, "Keep pulling until this many messages are received (0 pulls once)")
+	wait := fs.Duration("wait", 0, "With --count, stop pulling after this long (0 waits indefinitely)")
+	ackDeadline := fs.Duration("ack-deadline", 0, "With --no-ack, extend the ack deadline of pulled messages to this long; with --print, keep renewing it to this long until they're printed (default 1m, at most 10m)")
+	noAck := fs.Bool("no-ack", false, "Don't acknowledge messages, so they're redelivered after the ack deadline")
+	printFormat := fs.String("print", "", "Print only the messages as json, yaml, table or names")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		emulator := netConfig.PubSubEmulatorHost != ""
+		missingProject := *projectID == "" && !strings.HasPrefix(*subscription, "projects/")
+		if *subscription == "" || missingProject || (*tokenPath == "" && !emulator) {
+			cli.Fail(fs, "Missing required parameters")
+		}
+
+		if *printFormat != "" {
+			if !output.Valid(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected %s)\n", *printFormat, strings.Join(output.Formats, ", "))
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+		if *maxMessages < 1 || *count < 0 {
+			fmt.Fprintln(os.Stderr, "Error: --max-messages must be positive and --count not negative")
+			os.Exit(1)
+		}
+		if *ackDeadline < 0 || *ackDeadline > 10*time.Minute {
+			fmt.Fprintln(os.Stderr, "Error: --ack-deadline must be between 0 and 10m")
+			os.Exit(1)
+		}
+		// Without --no-ack or --print each batch is acknowledged as soon as
+		// it's shown, so a longer deadline would have no effect.
+		if *ackDeadline > 0 && !*noAck && *printFormat == "" {
+			fmt.Fprintln(os.Stderr, "Error: --ack-deadline only applies with --no-ack or --print, which leave messages unacknowledged for a while")
+			os.Exit(1)
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		// Retry notices go to stderr so they never mix with --print results.
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		client := &pubsub.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("pubsub"),
+			AccessToken: accessToken,
+		}
+		subscriptionName := pubsub.SubscriptionName(*projectID, *subscription)
+
+		fmt.Fprintln(cli.Log, "=== Pulling Pub/Sub Messages ===")
+		fmt.Fprintln(cli.Log, "Using the access token to read a subscription with the service account's identity")
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Calling Pub/Sub API:")
+		fmt.Fprintf(cli.Log, "  URL: %s\n", client.URL(subscriptionName, ":pull"))
+		fmt.Fprintf(cli.Log, "  Method: POST\n")
+		if emulator {
+			fmt.Fprintf(cli.Log, "  Emulator: %s\n", netConfig.PubSubEmulatorHost)
+		}
+		fmt.Fprintln(cli.Log)
+
+		ctx := context.Background()
+		var stopAt time.Time
+		if *wait > 0 {
+			stopAt = time.Now().Add(*wait)
+		}
+
+		// With --print the messages are printed after the loop, so they're
+		// acknowledged only then: an error before that leaves them to be
+		// redelivered instead of acknowledged and never shown. Meanwhile
+		// their ack deadline is renewed, so they aren't redelivered into
+		// this very stream.
+		pendingDeadline := *ackDeadline
+		if pendingDeadline == 0 {
+			pendingDeadline = defaultPendingAckDeadline
+		}
+		var received []pulledMessage
+		var pendingAckIDs []string
+		var renewedAt time.Time
+		seen := map[string]bool{}
+		for {
+			n := *maxMessages
+			if *count > 0 {
+				n = min(n, *count-len(received))
+			}
+
+			msgs, err := client.Pull(ctx, subscriptionName, n)
+			if err != nil {
+				cli.PrintError(os.Stderr, fmt.Errorf("failed to pull messages: %w", err))
+				os.Exit(1)
+			}
+
+			ackIDs := make([]string, 0, len(msgs))
+			for _, m := range msgs {
+				ackIDs = append(ackIDs, m.AckID)
+				// A message can be delivered more than once, e.g. when its
+				// deadline passes under --no-ack; it's shown and counted once.
+				if seen[m.Message.MessageID] {
+					continue
+				}
+				seen[m.Message.MessageID] = true
+				pm := toPulledMessage(m)
+				received = append(received, pm)
+				if *printFormat == "" {
+					printMessage(os.Stdout, len(received), pm)
+				}
+			}
+
+			switch {
+			case *noAck:
+				if len(ackIDs) > 0 && *ackDeadline > 0 {
+					extendDeadline(ctx, client, subscriptionName, ackIDs, *ackDeadline)
+				}
+			case *printFormat != "":
+				pendingAckIDs = append(pendingAckIDs, ackIDs...)
+				// Renew well before the deadline, allowing for a slow pull.
+				due := time.Since(renewedAt) >= pendingDeadline/3
+				if len(pendingAckIDs) > 0 && (len(ackIDs) > 0 || due) {
+					extendDeadline(ctx, client, subscriptionName, pendingAckIDs, pendingDeadline)
+					renewedAt = time.Now()
+				}
+			case len(ackIDs) > 0:
+				// Acknowledge each batch as soon as it's shown, before its ack
+				// deadline can pass while streaming.
+				acknowledge(ctx, client, subscriptionName, ackIDs)
+			}
+
+			if *count == 0 || len(received) >= *count {
+				break
+			}
+			if !stopAt.IsZero() && time.Now().After(stopAt) {
+				fmt.Fprintf(cli.Log, "Stopped after %s with %d of %d message(s)\n\n", *wait, len(received), *count)
+				break
+			}
+			if len(msgs) == 0 {
+				time.Sleep(emptyPullDelay)
+			}
+		}
+
+		if *printFormat != "" {
+			if err := printMessages(os.Stdout, *printFormat, received); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			if len(pendingAckIDs) > 0 {
+				acknowledge(ctx, client, subscriptionName, pendingAckIDs)
+			}
+			return
+		}
+
+		switch {
+		case len(received) == 0:
+			fmt.Fprintln(cli.Log, "No messages available.")
+			fmt.Fprintln(cli.Log, "Publish one with: ./bin/publish-messages --topic <TOPIC> --message hello ...")
+		case *noAck:
+			fmt.Fprintf(cli.Log, "✓ Received %d message(s), left unacknowledged\n", len(received))
+		default:
+			fmt.Fprintf(cli.Log, "✓ Received and acknowledged %d message(s)\n", len(received))
+		}
+	}
+}
+
+// extendDeadline sets the ack deadline of messages to d from now, exiting
+// on failure.
+func extendDeadline(ctx context.Context, client *pubsub.Client, subscriptionName string, ackIDs []string, d time.Duration) {
+	if err := client.ModifyAckDeadline(ctx, subscriptionName, ackIDs, int(d.Seconds())); err != nil {
+		cli.PrintError(os.Stderr, fmt.Errorf("failed to extend ack deadline: %w", err))
+		os.Exit(1)
+	}
+}
+
+// acknowledge acknowledges messages, exiting on failure; the messages are
+// then redelivered after their ack deadline.
+func acknowledge(ctx context.Context, client *pubsub.Client, subscriptionName string, ackIDs []string) {
+	if err := client.Acknowledge(ctx, subscriptionName, ackIDs); err != nil {
+		cli.PrintError(os.Stderr, fmt.Errorf("failed to acknowledge messages: %w", err))
+		os.Exit(1)
+	}
+}
+
+func toPulledMessage(m pubsub.ReceivedMessage) pulledMessage {
+	pm := pulledMessage{
+		MessageID:       m.Message.MessageID,
+		PublishTime:     m.Message.PublishTime,
+		OrderingKey:     m.Message.OrderingKey,
+		Attributes:      m.Message.Attributes,
+		DeliveryAttempt: m.DeliveryAttempt,
+	}
+	if utf8.Valid(m.Message.Data) {
+		pm.Data = string(m.Message.Data)
+	} else {
+		pm.DataBase64 = base64.StdEncoding.EncodeToString(m.Message.Data)
+	}
+	return pm
+}
+
+func printMessage(w io.Writer, n int, m pulledMessage) {
+	fmt.Fprintf(w, "Message %d:\n", n)
+	fmt.Fprintf(w, "  ID: %s\n", m.MessageID)
+	fmt.Fprintf(w, "  Published: %s\n", m.PublishTime)
+	if m.OrderingKey != "" {
+		fmt.Fprintf(w, "  Ordering key: %s\n", m.OrderingKey)
+	}
+	if m.DeliveryAttempt > 0 {
+		fmt.Fprintf(w, "  Delivery attempt: %d\n", m.DeliveryAttempt)
+	}
+	if len(m.Attributes) > 0 {
+		fmt.Fprintf(w, "  Attributes: %s\n", cli.FormatKeyValues(m.Attributes))
+	}
+	if m.DataBase64 != "" {
+		fmt.Fprintf(w, "  Data (base64): %s\n", m.DataBase64)
+	} else {
+		fmt.Fprintf(w, "  Data: %s\n", m.Data)
+	}
+	fmt.Fprintln(w)
+}
+
+func printMessages(w io.Writer, format string, messages []pulledMessage) error {
+	if messages == nil {
+		messages = []pulledMessage{}
+	}
+	switch format {
+	case "json":
+		return output.JSON(w, messages)
+	case "yaml":
+		return output.YAML(w, messages)
+	case "table":
+		var rows [][]string
+		for _, m := range messages {
+			data := m.Data
+			if m.DataBase64 != "" {
+				data = "base64:" + m.DataBase64
+			}
+			rows = append(rows, []string{m.MessageID, m.PublishTime, orDash(m.OrderingKey), orDash(cli.FormatKeyValues(m.Attributes)), strconv.Quote(truncate(data, 60))})
+		}
+		return output.Table(w, []string{"MESSAGE ID", "PUBLISHED", "ORDERING KEY", "ATTRIBUTES", "DATA"}, rows)
+	default:
+		ids := make([]string, 0, len(messages))
+		for _, m := range messages {
+			ids = append(ids, m.MessageID)
+		}
+		return output.Names(w, ids)
+	}
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
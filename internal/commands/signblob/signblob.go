@@ -0,0 +1,155 @@
+// Package signblob implements "wif sign blob" (sign-blob).
+package signblob
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/iamcredentials"
+	"wif-poc/internal/output"
+)
+
+// Command signs bytes with a service account's system-managed key.
+var Command = &cli.Command{
+	Name:     "sign blob",
+	Binary:   "sign-blob",
+	Summary:  "Sign bytes as a service account, without holding its key",
+	Synopsis: []string{"--service-account <SERVICE_ACCOUNT_EMAIL> --token-input <PATH> --input <PATH> --output <PATH> [--format raw|base64|json]"},
+	Examples: []string{
+		"--service-account my-sa@my-project.iam.gserviceaccount.com --token-input gcp_access_token.txt --input string_to_sign.txt --output signature.txt",
+	},
+	Setup: setup,
+}
+
+// result is the --print document.
+type result struct {
+	Path           string `json:"path"`
+	Format         string `json:"format"`
+	ServiceAccount string `json:"serviceAccount"`
+	KeyID          string `json:"keyId"`
+	SignatureBytes int    `json:"signatureBytes"`
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+func setup(fs *flag.FlagSet) func() {
+	serviceAccount := fs.String("service-account", "", "Service account email to sign as (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file from exchange-token, - for stdin (required)")
+	inputPath := fs.String("input", "", "Path to the bytes to sign, e.g. a V4 signed URL string-to-sign, - for stdin (required)")
+	outputPath := fs.String("output", "", "Path to save the signature, - for stdout (required)")
+	format := fs.String("format", "base64", "Output format: raw (signature bytes), base64 or json (keyId and signedBlob)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		if *serviceAccount == "" || *tokenPath == "" || *inputPath == "" || *outputPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+		if *printFormat != "" && *outputPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --print and --output - both write to stdout; save the signature to a file to use --print")
+			os.Exit(1)
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		if *format != "raw" && *format != "base64" && *format != "json" {
+			fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected raw, base64 or json)\n", *format)
+			os.Exit(1)
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(cli.Log, format, args...) }
+
+		fmt.Fprintln(cli.Log, "=== Signing a Blob as the Service Account ===")
+		fmt.Fprintln(cli.Log, "IAM Credentials signs with a Google-managed key, so no service account key file is needed")
+		fmt.Fprintln(cli.Log)
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		payload, err := cli.ReadFile(*inputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(1)
+		}
+
+		client := &iamcredentials.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("iamcredentials"),
+			AccessToken: accessToken,
+		}
+
+		fmt.Fprintln(cli.Log, "Calling IAM Credentials signBlob:")
+		fmt.Fprintf(cli.Log, "  URL: %s\n", client.MethodURL(*serviceAccount, "signBlob"))
+		fmt.Fprintf(cli.Log, "  Method: POST\n")
+		fmt.Fprintf(cli.Log, "  Payload: %d bytes from %s\n", len(payload), cli.InputName(*inputPath))
+		fmt.Fprintln(cli.Log)
+
+		resp, err := client.SignBlob(context.Background(), *serviceAccount, payload)
+		if err != nil {
+			cli.PrintError(os.Stderr, fmt.Errorf("failed to sign blob: %w", err))
+			os.Exit(1)
+		}
+
+		var data []byte
+		switch *format {
+		case "raw":
+			data = resp.SignedBlob
+		case "base64":
+			data = []byte(base64.StdEncoding.EncodeToString(resp.SignedBlob))
+		case "json":
+			data, err = json.MarshalIndent(resp, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error formatting response: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := cli.WriteFile(*outputPath, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing signature: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log, "✓ Blob signed")
+		fmt.Fprintf(cli.Log, "  Key ID: %s\n", resp.KeyID)
+		fmt.Fprintf(cli.Log, "  Signature: %d bytes (RSA-SHA256)\n", len(resp.SignedBlob))
+		fmt.Fprintf(cli.Log, "  Saved to: %s (%s)\n", cli.OutputName(*outputPath), *format)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Verify it against the service account's public certificate:")
+		fmt.Fprintf(cli.Log, "  https://www.googleapis.com/service_accounts/v1/metadata/x509/%s\n", *serviceAccount)
+
+		if *printFormat != "" {
+			r := result{Path: *outputPath, Format: *format, ServiceAccount: *serviceAccount, KeyID: resp.KeyID, SignatureBytes: len(resp.SignedBlob)}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
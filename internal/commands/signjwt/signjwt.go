@@ -0,0 +1,204 @@
+// Package signjwt implements "wif sign jwt" (sign-jwt).
+package signjwt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"wif-poc/internal/cli"
+	"wif-poc/internal/httpclient"
+	"wif-poc/internal/iamcredentials"
+	"wif-poc/internal/output"
+)
+
+// maxLifetime is the furthest in the future signJwt accepts for exp.
+const maxLifetime = 12 * time.Hour
+
+// Command signs a JWT as a service account.
+var Command = &cli.Command{
+	Name:     "sign jwt",
+	Binary:   "sign-jwt",
+	Summary:  "Sign a JWT as a service account, without holding its key",
+	Synopsis: []string{"--service-account <SERVICE_ACCOUNT_EMAIL> --token-input <PATH> --output <PATH> [--audience <AUD>] [--claims <PATH>] [--format raw|base64|json]"},
+	Notes:    []string{"iss, sub, iat and exp are added to the --claims claim set when missing."},
+	Examples: []string{
+		"--service-account my-sa@my-project.iam.gserviceaccount.com --token-input gcp_access_token.txt --audience https://pubsub.googleapis.com/ --output self_signed.jwt",
+	},
+	Setup: setup,
+}
+
+// result is the --print document.
+type result struct {
+	Path           string                 `json:"path"`
+	Format         string                 `json:"format"`
+	ServiceAccount string                 `json:"serviceAccount"`
+	KeyID          string                 `json:"keyId"`
+	Claims         map[string]interface{} `json:"claims"`
+}
+
+// netConfig holds the network flags; httpClient is built from it when the
+// command runs and shared by every request it makes.
+var (
+	netConfig  httpclient.Config
+	httpClient *httpclient.Client
+)
+
+func setup(fs *flag.FlagSet) func() {
+	serviceAccount := fs.String("service-account", "", "Service account email to sign as (required)")
+	tokenPath := fs.String("token-input", "", "Path to the GCP access token file from exchange-token, - for stdin (required)")
+	outputPath := fs.String("output", "", "Path to save the signed JWT, - for stdout (required)")
+	claimsPath := fs.String("claims", "", "Path to a JSON claim set to sign, - for stdin")
+	audience := fs.String("audience", "", "aud claim, e.g. the URL of the API the JWT is presented to")
+	subject := fs.String("subject", "", "sub claim (defaults to the service account)")
+	lifetime := fs.Duration("lifetime", time.Hour, "exp is set this far in the future when the claim set has none (at most 12h)")
+	format := fs.String("format", "raw", "Output format: raw (compact JWT), base64 or json (keyId and signedJwt)")
+	printFormat := fs.String("print", "", "Print the result as json, yaml or table on stdout (drops the tutorial text)")
+	netConfig.RegisterFlags(fs)
+
+	return func() {
+		if *serviceAccount == "" || *tokenPath == "" || *outputPath == "" {
+			cli.Fail(fs, "Missing required parameters")
+		}
+		if *printFormat != "" && *outputPath == cli.Stdio {
+			fmt.Fprintln(os.Stderr, "Error: --print and --output - both write to stdout; save the signed JWT to a file to use --print")
+			os.Exit(1)
+		}
+		if *printFormat != "" {
+			if !output.ValidDocument(*printFormat) {
+				fmt.Fprintf(os.Stderr, "Error: unknown --print %q (expected json, yaml or table)\n", *printFormat)
+				os.Exit(1)
+			}
+			cli.Log = io.Discard
+		}
+
+		if *format != "raw" && *format != "base64" && *format != "json" {
+			fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected raw, base64 or json)\n", *format)
+			os.Exit(1)
+		}
+		if *lifetime <= 0 || *lifetime > maxLifetime {
+			fmt.Fprintf(os.Stderr, "Error: --lifetime must be between 0 and %s\n", maxLifetime)
+			os.Exit(1)
+		}
+
+		var err error
+		httpClient, err = netConfig.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring HTTP client: %v\n", err)
+			os.Exit(1)
+		}
+		httpClient.Logf = func(format string, args ...any) { fmt.Fprintf(cli.Log, format, args...) }
+
+		fmt.Fprintln(cli.Log, "=== Signing a JWT as the Service Account ===")
+		fmt.Fprintln(cli.Log, "IAM Credentials signs with a Google-managed key, so no service account key file is needed")
+		fmt.Fprintln(cli.Log)
+
+		accessToken, err := cli.ReadAccessToken(*tokenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading access token: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Make sure to run exchange-token first!")
+			os.Exit(1)
+		}
+
+		claims := map[string]interface{}{}
+		if *claimsPath != "" {
+			data, err := cli.ReadFile(*claimsPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading claims: %v\n", err)
+				os.Exit(1)
+			}
+			if err := json.Unmarshal(data, &claims); err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing claims: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		applyDefaultClaims(claims, *serviceAccount, *subject, *audience, time.Now(), *lifetime)
+
+		claimsJSON, err := json.Marshal(claims)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding claims: %v\n", err)
+			os.Exit(1)
+		}
+
+		client := &iamcredentials.Client{
+			HTTP:        httpClient,
+			BaseURL:     netConfig.ServiceURL("iamcredentials"),
+			AccessToken: accessToken,
+		}
+
+		fmt.Fprintln(cli.Log, "Calling IAM Credentials signJwt:")
+		fmt.Fprintf(cli.Log, "  URL: %s\n", client.MethodURL(*serviceAccount, "signJwt"))
+		fmt.Fprintf(cli.Log, "  Method: POST\n")
+		indented, _ := json.MarshalIndent(claims, "  ", "  ")
+		fmt.Fprintf(cli.Log, "  Claims: %s\n", indented)
+		fmt.Fprintln(cli.Log)
+
+		resp, err := client.SignJWT(context.Background(), *serviceAccount, string(claimsJSON))
+		if err != nil {
+			cli.PrintError(os.Stderr, fmt.Errorf("failed to sign JWT: %w", err))
+			os.Exit(1)
+		}
+
+		var data []byte
+		switch *format {
+		case "raw":
+			data = []byte(resp.SignedJWT)
+		case "base64":
+			data = []byte(base64.StdEncoding.EncodeToString([]byte(resp.SignedJWT)))
+		case "json":
+			data, err = json.MarshalIndent(resp, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error formatting response: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := cli.WriteFile(*outputPath, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing signed JWT: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cli.Log, "✓ JWT signed")
+		fmt.Fprintf(cli.Log, "  Key ID: %s\n", resp.KeyID)
+		fmt.Fprintf(cli.Log, "  Saved to: %s (%s)\n", cli.OutputName(*outputPath), *format)
+		fmt.Fprintln(cli.Log)
+		fmt.Fprintln(cli.Log, "Verify it against the service account's public keys:")
+		fmt.Fprintf(cli.Log, "  https://www.googleapis.com/service_accounts/v1/jwk/%s\n", *serviceAccount)
+
+		if *printFormat != "" {
+			r := result{Path: *outputPath, Format: *format, ServiceAccount: *serviceAccount, KeyID: resp.KeyID, Claims: claims}
+			if err := output.Document(os.Stdout, *printFormat, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// applyDefaultClaims fills in the claims a self-signed service account JWT
+// needs. Explicit --subject and --audience values win over the claim set;
+// iss, iat and exp are only added when missing.
+func applyDefaultClaims(claims map[string]interface{}, serviceAccount, subject, audience string, now time.Time, lifetime time.Duration) {
+	if _, ok := claims["iss"]; !ok {
+		claims["iss"] = serviceAccount
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	} else if _, ok := claims["sub"]; !ok {
+		claims["sub"] = serviceAccount
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(lifetime).Unix()
+	}
+}
@@ -0,0 +1,189 @@
+// Package config reads the profiles file, which holds flag values per named
+// federation (e.g. dev, staging, prod) so they needn't be repeated on every
+// command line:
+//
+//	default-profile: dev
+//	profiles:
+//	  dev:
+//	    project-number: 123456789
+//	    pool-id: dev-pool
+//	    provider-id: dev-provider
+//	    service-account: wif-dev@my-project.iam.gserviceaccount.com
+//	    resource:
+//	      - projects/my-project
+//	      - projects/my-project/topics/wif-test
+//
+// Keys are flag names without the dashes; a list sets a repeatable flag once
+// per item. A profile may hold flags of any command, and each command uses
+// the ones it has. A key prefixed with a command, e.g. create-jwt.audience,
+// sets the flag for that command alone.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Environment variables selecting the file and the profile when --config
+// and --profile aren't given.
+const (
+	EnvConfig  = "WIF_CONFIG"
+	EnvProfile = "WIF_PROFILE"
+)
+
+// File is a parsed profiles file.
+type File struct {
+	DefaultProfile string
+	Profiles       map[string]Profile
+}
+
+// Profile maps flag names to their values.
+type Profile map[string][]string
+
+// DefaultPath returns the per-user profiles file, e.g.
+// ~/.config/wif-poc/config.yaml.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "wif-poc", "config.yaml")
+}
+
+// Load reads and parses the profiles file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return file, nil
+}
+
+// Parse parses a profiles file. Errors start with the line number.
+func Parse(data []byte) (*File, error) {
+	root, err := parseYAML(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Profiles: map[string]Profile{}}
+	for _, key := range root.keys {
+		value := root.values[key]
+		switch key {
+		case "default-profile":
+			if value.scalar == nil {
+				return nil, fmt.Errorf("%d: default-profile must be a profile name", value.line)
+			}
+			file.DefaultProfile = *value.scalar
+		case "profiles":
+			if value.mapping == nil {
+				return nil, fmt.Errorf("%d: profiles must map profile names to flags", value.line)
+			}
+			for _, name := range value.mapping.keys {
+				profile, err := parseProfile(value.mapping.values[name])
+				if err != nil {
+					return nil, err
+				}
+				file.Profiles[name] = profile
+			}
+		default:
+			return nil, fmt.Errorf("%d: unknown key %q (expected default-profile or profiles)", value.line, key)
+		}
+	}
+
+	if file.DefaultProfile != "" && file.Profiles[file.DefaultProfile] == nil {
+		return nil, fmt.Errorf("%d: default-profile %q is not defined under profiles", root.values["default-profile"].line, file.DefaultProfile)
+	}
+	return file, nil
+}
+
+func parseProfile(n *node) (Profile, error) {
+	if n.mapping == nil {
+		return nil, fmt.Errorf("%d: a profile must map flag names to values", n.line)
+	}
+	profile := Profile{}
+	for _, flagName := range n.mapping.keys {
+		value := n.mapping.values[flagName]
+		switch {
+		case value.scalar != nil:
+			profile[flagName] = []string{*value.scalar}
+		case value.list != nil:
+			profile[flagName] = value.list
+		default:
+			return nil, fmt.Errorf("%d: %s must be a value or a list of values", value.line, flagName)
+		}
+	}
+	return profile, nil
+}
+
+// Profile returns the named profile, or the default profile when name is
+// empty. It returns nil when no profile is selected.
+func (f *File) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" {
+		return nil, nil
+	}
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found (defined: %s)", name, strings.Join(f.names(), ", "))
+	}
+	return profile, nil
+}
+
+func (f *File) names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return []string{"none"}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadProfile returns the profile to take flag values from. path and name
+// come from --config and --profile; when empty, EnvConfig and EnvProfile
+// are consulted, then DefaultPath and the file's default-profile. A missing
+// default file means no profile.
+func LoadProfile(path, name string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+	}
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+
+	file, err := Load(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		if name != "" {
+			return nil, fmt.Errorf("profile %q selected, but there is no profiles file at %s", name, path)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	return file.Profile(name)
+}
+
+// EnvName returns the environment variable overriding a flag, e.g.
+// WIF_PROJECT_NUMBER for --project-number.
+func EnvName(flagName string) string {
+	return "WIF_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
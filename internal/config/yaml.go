@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The profiles file is read with a small YAML subset, enough for its two
+// levels of keys: block mappings indented with spaces, plain, single- or
+// double-quoted scalars, block lists ("- item") and flow lists ("[a, b]"),
+// and # comments. Anchors, multi-line strings and nested lists aren't
+// supported.
+
+type node struct {
+	line    int
+	scalar  *string
+	list    []string
+	mapping *mapping
+}
+
+// mapping keeps its keys in file order.
+type mapping struct {
+	keys   []string
+	values map[string]*node
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(src string) (*mapping, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(src, "\n") {
+		text, err := stripComment(strings.TrimRight(raw, " \t\r"))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", i+1, err)
+		}
+		trimmed := strings.TrimLeft(text, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if strings.Contains(text[:len(text)-len(trimmed)], "\t") {
+			return nil, fmt.Errorf("%d: indent with spaces, not tabs", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimSpace(trimmed)})
+	}
+
+	p := &yamlParser{lines: lines}
+	if len(lines) == 0 {
+		return &mapping{values: map[string]*node{}}, nil
+	}
+	root, err := p.mapping(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, fmt.Errorf("%d: unexpected indentation", lines[p.pos].num)
+	}
+	return root, nil
+}
+
+func (p *yamlParser) mapping(indent int) (*mapping, error) {
+	m := &mapping{values: map[string]*node{}}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("%d: unexpected indentation", l.num)
+		}
+		key, rest, ok := strings.Cut(l.text, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || isListItem(l.text) {
+			return nil, fmt.Errorf("%d: expected \"key: value\"", l.num)
+		}
+		if _, dup := m.values[key]; dup {
+			return nil, fmt.Errorf("%d: duplicate key %q", l.num, key)
+		}
+		p.pos++
+
+		n := &node{line: l.num}
+		rest = strings.TrimSpace(rest)
+		var err error
+		switch {
+		case strings.HasPrefix(rest, "["):
+			if n.list, err = flowList(rest); err != nil {
+				return nil, fmt.Errorf("%d: %w", l.num, err)
+			}
+		case rest != "":
+			s, err := scalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", l.num, err)
+			}
+			n.scalar = &s
+		case p.pos < len(p.lines) && isListItem(p.lines[p.pos].text) && p.lines[p.pos].indent >= indent:
+			n.list, err = p.list(p.lines[p.pos].indent)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+			n.mapping, err = p.mapping(p.lines[p.pos].indent)
+		default:
+			// "key:" alone is null in YAML; an empty value is close enough.
+			empty := ""
+			n.scalar = &empty
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+		m.values[key] = n
+	}
+	return m, nil
+}
+
+func (p *yamlParser) list(indent int) ([]string, error) {
+	items := []string{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isListItem(l.text) {
+			break
+		}
+		item, err := scalar(strings.TrimSpace(strings.TrimPrefix(l.text, "-")))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", l.num, err)
+		}
+		items = append(items, item)
+		p.pos++
+		if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+			return nil, fmt.Errorf("%d: list items must be single values", p.lines[p.pos].num)
+		}
+	}
+	return items, nil
+}
+
+func isListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// flowList parses "[a, b, c]". Items can't contain commas.
+func flowList(s string) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %s", s)
+	}
+	items := []string{}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	if inner == "" {
+		return items, nil
+	}
+	for _, part := range strings.Split(inner, ",") {
+		item, err := scalar(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// scalar unquotes a single- or double-quoted value; others are taken as
+// written, so numbers like project numbers stay strings.
+func scalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted value %s", s)
+		}
+		return value, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid single-quoted value %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// stripComment removes a # comment, which starts a line or follows a space,
+// outside of quotes.
+func stripComment(line string) (string, error) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote == '\'' && c == '\'' && i+1 < len(line) && line[i+1] == '\'':
+			i++ // '' is an escaped quote
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '[' || line[i-1] == ',' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i], nil
+		}
+	}
+	if quote != 0 {
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+	return line, nil
+}
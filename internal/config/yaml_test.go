@@ -0,0 +1,219 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want *File
+	}{
+		{
+			name: "empty",
+			src:  "# nothing yet\n\n",
+			want: &File{Profiles: map[string]Profile{}},
+		},
+		{
+			name: "nested profiles",
+			src: `default-profile: dev
+profiles:
+  dev:
+    project-number: 123456789
+    pool-id: dev-pool
+    resource:
+      - projects/my-project
+      - projects/my-project/topics/wif-test
+  prod:
+    pool-id: prod-pool
+    resource: [projects/a, 'projects/b']
+    quiet:
+`,
+			want: &File{
+				DefaultProfile: "dev",
+				Profiles: map[string]Profile{
+					"dev": {
+						"project-number": {"123456789"},
+						"pool-id":        {"dev-pool"},
+						"resource":       {"projects/my-project", "projects/my-project/topics/wif-test"},
+					},
+					"prod": {
+						"pool-id":  {"prod-pool"},
+						"resource": {"projects/a", "projects/b"},
+						"quiet":    {""},
+					},
+				},
+			},
+		},
+		{
+			name: "list at the key's indentation",
+			src: `profiles:
+  dev:
+    resource:
+    - projects/a
+    - projects/b
+`,
+			want: &File{Profiles: map[string]Profile{"dev": {"resource": {"projects/a", "projects/b"}}}},
+		},
+		{
+			name: "comments and quoted #",
+			src: `# profiles
+profiles:   # by federation
+  dev:
+    audience: "aud # not a comment"
+    issuer: 'https://idp.example.com/#frag'
+    key-id: key#1
+    pool-id: dev-pool # a comment
+    provider-id: dev-provider	# after a tab
+`,
+			want: &File{Profiles: map[string]Profile{"dev": {
+				"audience":    {"aud # not a comment"},
+				"issuer":      {"https://idp.example.com/#frag"},
+				"key-id":      {"key#1"},
+				"pool-id":     {"dev-pool"},
+				"provider-id": {"dev-provider"},
+			}}},
+		},
+		{
+			name: "quote escapes",
+			src: `profiles:
+  dev:
+    single: 'it''s'
+    single-hash: 'a'' # b'
+    double: "say \"hi\"\tthere"
+    empty: ''
+    inner: it's
+`,
+			want: &File{Profiles: map[string]Profile{"dev": {
+				"single":      {"it's"},
+				"single-hash": {"a' # b"},
+				"double":      {"say \"hi\"\tthere"},
+				"empty":       {""},
+				"inner":       {"it's"},
+			}}},
+		},
+		{
+			name: "CRLF line endings",
+			src:  "profiles:\r\n  dev:\r\n    pool-id: dev-pool\r\n",
+			want: &File{Profiles: map[string]Profile{"dev": {"pool-id": {"dev-pool"}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{
+			name:    "tab indentation",
+			src:     "profiles:\n  dev:\n\tpool-id: dev-pool\n",
+			wantErr: "3: indent with spaces, not tabs",
+		},
+		{
+			name:    "duplicate profile key",
+			src:     "profiles:\n  dev:\n    pool-id: a\n    pool-id: b\n",
+			wantErr: `4: duplicate key "pool-id"`,
+		},
+		{
+			name:    "duplicate profile",
+			src:     "profiles:\n  dev:\n    pool-id: a\n  dev:\n    pool-id: b\n",
+			wantErr: `4: duplicate key "dev"`,
+		},
+		{
+			name:    "duplicate top-level key",
+			src:     "default-profile: dev\n\n# again\ndefault-profile: prod\n",
+			wantErr: `4: duplicate key "default-profile"`,
+		},
+		{
+			name:    "unterminated double quote",
+			src:     "profiles:\n  dev:\n    audience: \"aud\n",
+			wantErr: "3: unterminated quoted value",
+		},
+		{
+			name:    "unterminated single quote",
+			src:     "profiles:\n  dev:\n    audience: 'it''s\n",
+			wantErr: "3: unterminated quoted value",
+		},
+		{
+			name:    "invalid double-quoted value",
+			src:     "profiles:\n  dev:\n    audience: \"a\" b\n",
+			wantErr: `3: invalid double-quoted value "a" b`,
+		},
+		{
+			name:    "unterminated flow list",
+			src:     "profiles:\n  dev:\n    resource: [a, b\n",
+			wantErr: "3: unterminated list [a, b",
+		},
+		{
+			name:    "deeper indentation",
+			src:     "profiles:\n  dev:\n    pool-id: a\n      provider-id: b\n",
+			wantErr: "4: unexpected indentation",
+		},
+		{
+			name:    "shallower indentation",
+			src:     "  profiles:\n    dev:\n      pool-id: a\nquiet: true\n",
+			wantErr: "4: unexpected indentation",
+		},
+		{
+			name:    "not a key",
+			src:     "profiles:\n  dev:\n    pool-id\n",
+			wantErr: `3: expected "key: value"`,
+		},
+		{
+			name:    "nested list",
+			src:     "profiles:\n  dev:\n    resource:\n      - a\n        - b\n",
+			wantErr: "5: list items must be single values",
+		},
+		{
+			name:    "unknown top-level key",
+			src:     "profiles:\n  dev:\n    pool-id: a\npool-id: b\n",
+			wantErr: `4: unknown key "pool-id" (expected default-profile or profiles)`,
+		},
+		{
+			name:    "profiles is a value",
+			src:     "default-profile: dev\nprofiles: dev\n",
+			wantErr: "2: profiles must map profile names to flags",
+		},
+		{
+			name:    "profile is a value",
+			src:     "profiles:\n  dev: dev-pool\n",
+			wantErr: "2: a profile must map flag names to values",
+		},
+		{
+			name:    "flag is a mapping",
+			src:     "profiles:\n  dev:\n    pool-id:\n      id: a\n",
+			wantErr: "3: pool-id must be a value or a list of values",
+		},
+		{
+			name:    "undefined default profile",
+			src:     "profiles:\n  dev:\n    pool-id: a\ndefault-profile: prod\n",
+			wantErr: `4: default-profile "prod" is not defined under profiles`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			if err == nil {
+				t.Fatalf("Parse() succeeded, want error %q", tt.wantErr)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("Parse() error = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
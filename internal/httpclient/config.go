@@ -0,0 +1,162 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUniverseDomain is the domain of the public Google Cloud APIs.
+const DefaultUniverseDomain = "googleapis.com"
+
+// Environment variables consulted for flag defaults. HTTPS_PROXY, HTTP_PROXY
+// and NO_PROXY are honored as usual when no proxy is configured.
+const (
+	EnvProxy          = "WIF_PROXY"
+	EnvCAFiles        = "WIF_CA_FILES" // comma-separated
+	EnvUniverseDomain = "GOOGLE_CLOUD_UNIVERSE_DOMAIN"
+	EnvEndpointBase   = "WIF_ENDPOINT_BASE"
+	EnvTimeout        = "WIF_TIMEOUT"
+	EnvMaxAttempts    = "WIF_MAX_ATTEMPTS"
+
+	// EnvPubSubEmulatorHost points Pub/Sub calls at the emulator
+	// (host:port, plain HTTP), as in the Google client libraries.
+	EnvPubSubEmulatorHost = "PUBSUB_EMULATOR_HOST"
+)
+
+// Config holds the network settings shared by every command.
+type Config struct {
+	Timeout        time.Duration
+	MaxAttempts    int
+	Proxy          string
+	CAFiles        []string
+	UniverseDomain string
+	EndpointBase   string
+
+	PubSubEmulatorHost string
+}
+
+// RegisterFlags adds the network flags to fs, with defaults taken from the
+// environment.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	timeout := DefaultTimeout
+	if d, err := time.ParseDuration(os.Getenv(EnvTimeout)); err == nil {
+		timeout = d
+	}
+	maxAttempts := DefaultMaxAttempts
+	if n, err := strconv.Atoi(os.Getenv(EnvMaxAttempts)); err == nil {
+		maxAttempts = n
+	}
+	universe := os.Getenv(EnvUniverseDomain)
+	if universe == "" {
+		universe = DefaultUniverseDomain
+	}
+	// The environment's CA files are a default: the first --ca-file
+	// replaces them rather than adding to them.
+	caFilesFromEnv := false
+	if files := os.Getenv(EnvCAFiles); files != "" {
+		c.CAFiles = strings.Split(files, ",")
+		caFilesFromEnv = true
+	}
+	c.PubSubEmulatorHost = os.Getenv(EnvPubSubEmulatorHost)
+
+	fs.DurationVar(&c.Timeout, "timeout", timeout, "Deadline for each HTTP request attempt (env "+EnvTimeout+")")
+	fs.IntVar(&c.MaxAttempts, "max-attempts", maxAttempts, "Attempts per HTTP request for 429, 5xx and network errors (env "+EnvMaxAttempts+")")
+	fs.StringVar(&c.Proxy, "proxy", os.Getenv(EnvProxy), "HTTP(S) proxy URL (env "+EnvProxy+", falls back to HTTPS_PROXY/HTTP_PROXY)")
+	fs.Func("ca-file", "Extra root CA PEM file to trust, repeatable (env "+EnvCAFiles+", comma-separated)", func(path string) error {
+		if caFilesFromEnv {
+			c.CAFiles, caFilesFromEnv = nil, false
+		}
+		c.CAFiles = append(c.CAFiles, path)
+		return nil
+	})
+	fs.StringVar(&c.UniverseDomain, "universe-domain", universe, "Universe domain of the Google APIs (env "+EnvUniverseDomain+")")
+	fs.StringVar(&c.EndpointBase, "endpoint-base", os.Getenv(EnvEndpointBase), "Base URL replacing every Google API endpoint, e.g. a private gateway or local fake (env "+EnvEndpointBase+")")
+}
+
+// flagEnv maps the flags RegisterFlags adds to the environment variables
+// of their defaults.
+var flagEnv = map[string]string{
+	"timeout":         EnvTimeout,
+	"max-attempts":    EnvMaxAttempts,
+	"proxy":           EnvProxy,
+	"ca-file":         EnvCAFiles,
+	"universe-domain": EnvUniverseDomain,
+	"endpoint-base":   EnvEndpointBase,
+}
+
+// IsFlag reports whether name is one of the flags RegisterFlags adds.
+func IsFlag(name string) bool {
+	_, ok := flagEnv[name]
+	return ok
+}
+
+// EnvName returns the environment variable a network flag defaults to, or
+// "" for other flags.
+func EnvName(name string) string {
+	return flagEnv[name]
+}
+
+// NewClient builds a Client from the configuration.
+func (c *Config) NewClient() (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if len(c.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range c.CAFiles {
+			caPEM, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("no certificates found in %s", path)
+			}
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	client := New()
+	client.HTTPClient = &http.Client{Transport: transport}
+	if c.Timeout > 0 {
+		client.Timeout = c.Timeout
+	}
+	if c.MaxAttempts > 0 {
+		client.MaxAttempts = c.MaxAttempts
+	}
+	return client, nil
+}
+
+// ServiceURL returns the base URL of a Google API such as "sts" or
+// "pubsub": the Pub/Sub emulator for "pubsub" when configured, then the
+// endpoint base when set, otherwise https://SERVICE.UNIVERSE_DOMAIN.
+func (c *Config) ServiceURL(service string) string {
+	if service == "pubsub" && c.PubSubEmulatorHost != "" {
+		return "http://" + c.PubSubEmulatorHost
+	}
+	if c.EndpointBase != "" {
+		return strings.TrimSuffix(c.EndpointBase, "/")
+	}
+	universe := c.UniverseDomain
+	if universe == "" {
+		universe = DefaultUniverseDomain
+	}
+	return "https://" + service + "." + universe
+}
@@ -0,0 +1,258 @@
+// Package httpclient is the HTTP layer shared by the network commands. It
+// applies a deadline to every attempt and retries 429, 5xx and transient
+// network errors with exponential backoff and jitter, honoring Retry-After.
+// Other 4xx responses, including authentication and permission errors, are
+// returned immediately.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"wif-poc/internal/apierror"
+)
+
+const (
+	DefaultTimeout     = 30 * time.Second
+	DefaultMaxAttempts = 4
+	DefaultBaseDelay   = 500 * time.Millisecond
+	DefaultMaxDelay    = 30 * time.Second
+)
+
+// Client sends requests with per-attempt deadlines and retries.
+type Client struct {
+	HTTPClient  *http.Client
+	Timeout     time.Duration // deadline for each attempt, including reading the body
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration // upper bound for backoff and Retry-After waits
+
+	// Logf, when set, is called before each retry.
+	Logf func(format string, args ...any)
+}
+
+// New returns a Client with the default timeout and retry policy.
+func New() *Client {
+	return &Client{
+		HTTPClient:  &http.Client{},
+		Timeout:     DefaultTimeout,
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+	}
+}
+
+// Response is a fully read HTTP response.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Do sends a request and returns the response of the last attempt. Non-2xx
+// responses are not errors; callers inspect StatusCode. An error is returned
+// only when no response could be obtained.
+func (c *Client) Do(ctx context.Context, method, rawURL string, header http.Header, body []byte) (*Response, error) {
+	attempts := c.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.once(ctx, method, rawURL, header, body)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if err != nil && !retryableError(ctx, err) {
+			return nil, err
+		}
+		if attempt >= attempts {
+			if err != nil {
+				return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return resp, nil
+		}
+
+		delay := c.backoff(attempt)
+		reason := err
+		if err == nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = min(after, c.MaxDelay)
+			}
+			reason = fmt.Errorf("status %d", resp.StatusCode)
+		}
+
+		if c.Logf != nil {
+			c.Logf("  Attempt %d of %d failed (%v), retrying in %s...\n", attempt, attempts, reason, delay.Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// PostForm sends an application/x-www-form-urlencoded POST.
+func (c *Client) PostForm(ctx context.Context, rawURL string, values url.Values) (*Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.Do(ctx, "POST", rawURL, header, []byte(values.Encode()))
+}
+
+// CallJSON sends request, when not nil, as JSON with the bearer token and
+// decodes a 200 response into response. Other statuses are returned as an
+// *apierror.Error of api, e.g. "IAM".
+func (c *Client) CallJSON(ctx context.Context, api, method, rawURL, accessToken string, request, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+accessToken)
+	header.Set("Content-Type", "application/json")
+
+	resp, err := c.Do(ctx, method, rawURL, header, body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return apierror.Parse(api, resp.StatusCode, resp.Body)
+	}
+
+	if err := json.Unmarshal(resp.Body, response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) once(ctx context.Context, method, rawURL string, header http.Header, body []byte) (*Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request creation failed: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody}, nil
+}
+
+// backoff returns the full-jitter delay before retry number attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > c.MaxDelay {
+		ceiling = c.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling))) + 1
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableError reports whether a transport error is worth retrying: the
+// attempt timed out or the connection failed, and the caller's own context
+// is still alive.
+func retryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || permanentError(err) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// Dial, read and write failures.
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// permanentError reports whether a transport error will recur on every
+// attempt: the host name doesn't exist, the server's certificate doesn't
+// verify, or the URL is malformed.
+func permanentError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return true
+	}
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &verifyErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Op == "parse"
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0), true
+	}
+	return 0, false
+}
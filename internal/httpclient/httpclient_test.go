@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// dialError is how the transport reports a failed connection.
+func dialError(err error) error {
+	return &url.Error{Op: "Get", URL: "https://sts.googleapis.com/v1/token", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+}
+
+func TestRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", dialError(&net.OpError{Op: "connect", Err: syscall.ECONNREFUSED}), true},
+		{"connection reset", fmt.Errorf("HTTP request failed: %w", syscall.ECONNRESET), true},
+		{"attempt timed out", fmt.Errorf("HTTP request failed: %w", context.DeadlineExceeded), true},
+		{"DNS server unreachable", dialError(&net.DNSError{Err: "i/o timeout", Name: "sts.googleapis.com", IsTimeout: true}), true},
+		{"host not found", dialError(&net.DNSError{Err: "no such host", Name: "sts.example.invalid", IsNotFound: true}), false},
+		{"unknown authority", &url.Error{Op: "Get", URL: "https://proxy.example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{"wrong host name", &url.Error{Op: "Get", URL: "https://proxy.example.com", Err: x509.HostnameError{Host: "proxy.example.com"}}, false},
+		{"expired certificate", &url.Error{Op: "Get", URL: "https://proxy.example.com", Err: x509.CertificateInvalidError{Reason: x509.Expired}}, false},
+		{"malformed URL", fmt.Errorf("HTTP request creation failed: %w", &url.Error{Op: "parse", URL: "https://[::1", Err: errors.New("missing ']' in host")}), false},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "sts.googleapis.com/v1/token", Err: errors.New(`unsupported protocol scheme ""`)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableError(context.Background(), tt.err); got != tt.want {
+				t.Errorf("retryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if retryableError(ctx, dialError(syscall.ECONNREFUSED)) {
+		t.Error("retried after the caller's context was canceled")
+	}
+}
+
+// newTestClient returns a client that retries at once, counting retries.
+func newTestClient(retries *int) *Client {
+	c := New()
+	c.MaxAttempts = 3
+	c.BaseDelay = time.Millisecond
+	c.MaxDelay = time.Millisecond
+	c.Logf = func(string, ...any) { *retries++ }
+	return c
+}
+
+func TestDoDoesNotRetryPermanentErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"untrusted certificate", server.URL},
+		{"malformed URL", "https://[::1"},
+		{"no scheme", "sts.googleapis.com/v1/token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var retries int
+			if _, err := newTestClient(&retries).Do(context.Background(), "GET", tt.url, nil, nil); err == nil {
+				t.Fatal("Do() succeeded")
+			}
+			if retries != 0 {
+				t.Errorf("retried %d times", retries)
+			}
+		})
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var retries int
+	resp, err := newTestClient(&retries).Do(context.Background(), "GET", server.URL, nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Do() = %v, %v; want 200 on the third attempt", resp, err)
+	}
+	if retries != 2 {
+		t.Errorf("retried %d times, want 2", retries)
+	}
+
+	// A closed port fails every attempt, each one retried.
+	server.Close()
+	retries = 0
+	if _, err := newTestClient(&retries).Do(context.Background(), "GET", server.URL, nil, nil); err == nil {
+		t.Fatal("Do() to a closed server succeeded")
+	}
+	if retries != 2 {
+		t.Errorf("retried a refused connection %d times, want 2", retries)
+	}
+}
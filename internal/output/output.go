@@ -0,0 +1,236 @@
+// Package output renders command results in the machine-readable formats
+// selected with --print: JSON, YAML, aligned tables and plain names.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats lists the values accepted by --print for lists of API resources.
+var Formats = []string{"json", "yaml", "table", "names"}
+
+// DocumentFormats lists the values accepted by --print for a single result
+// document, which has no names.
+var DocumentFormats = []string{"json", "yaml", "table"}
+
+// Valid reports whether format is one of Formats.
+func Valid(format string) bool {
+	return contains(Formats, format)
+}
+
+// ValidDocument reports whether format is one of DocumentFormats.
+func ValidDocument(format string) bool {
+	return contains(DocumentFormats, format)
+}
+
+func contains(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON writes v as indented JSON.
+func JSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// YAML writes v as block-style YAML. v is first converted to its JSON form,
+// so struct tags apply and maps come out with sorted keys.
+func YAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	writeYAML(&b, generic, 0, false)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writeYAML appends v at the given indent. inline is set when v follows a
+// "key:" or "- " on the current line.
+func writeYAML(b *strings.Builder, v interface{}, indent int, inline bool) {
+	pad := strings.Repeat("  ", indent)
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			b.WriteString(lead(inline) + "{}\n")
+			return
+		}
+		if inline {
+			b.WriteString("\n")
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b.WriteString(pad + yamlString(key) + ":")
+			writeYAML(b, v[key], indent+1, true)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString(lead(inline) + "[]\n")
+			return
+		}
+		if inline {
+			b.WriteString("\n")
+		}
+		for _, item := range v {
+			b.WriteString(pad + "-")
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				// Put the first key on the dash line, the rest aligned below.
+				var sub strings.Builder
+				writeYAML(&sub, m, indent+1, false)
+				b.WriteString(" " + strings.TrimPrefix(sub.String(), pad+"  "))
+				continue
+			}
+			writeYAML(b, item, indent+1, true)
+		}
+	default:
+		b.WriteString(lead(inline) + yamlScalar(v) + "\n")
+	}
+}
+
+func lead(inline bool) string {
+	if inline {
+		return " "
+	}
+	return ""
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return yamlString(v)
+	default:
+		return yamlString(fmt.Sprint(v))
+	}
+}
+
+// yamlString quotes s when it would otherwise read as another type or
+// contains YAML syntax.
+func yamlString(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n\t") ||
+		strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") ||
+		strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Table writes rows as aligned columns under header.
+func Table(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Fields writes the top-level fields of a resource as a FIELD/VALUE table.
+// Nested values are shown as compact JSON.
+func Fields(w io.Writer, resource map[string]interface{}) error {
+	keys := make([]string, 0, len(resource))
+	for key := range resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		value := resource[key]
+		text, ok := value.(string)
+		if !ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			text = string(data)
+		}
+		rows = append(rows, []string{key, text})
+	}
+	return Table(w, []string{"FIELD", "VALUE"}, rows)
+}
+
+// Resource writes a single API resource in format; names prints its "name"
+// field.
+func Resource(w io.Writer, format string, resource map[string]interface{}) error {
+	switch format {
+	case "json":
+		return JSON(w, resource)
+	case "yaml":
+		return YAML(w, resource)
+	case "table":
+		return Fields(w, resource)
+	default:
+		name, _ := resource["name"].(string)
+		return Names(w, []string{name})
+	}
+}
+
+// Document writes the result document of a command in format; table lists
+// its top-level fields.
+func Document(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case "json":
+		return JSON(w, v)
+	case "yaml":
+		return YAML(w, v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		return Fields(w, fields)
+	}
+}
+
+// Names writes one name per line.
+func Names(w io.Writer, names []string) error {
+	for _, name := range names {
+		if _, err := fmt.Fprintln(w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package pubsub is a small client for the Pub/Sub REST API, enough for the
+// commands to publish, pull and acknowledge messages with an access token.
+package pubsub
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wif-poc/internal/apierror"
+	"wif-poc/internal/httpclient"
+)
+
+// Limits of a single publish request.
+const (
+	MaxBatchMessages = 1000
+	MaxBatchBytes    = 9 << 20 // encoded size, below the 10MB request limit
+)
+
+// messageOverhead is a generous allowance for the JSON around one message
+// in a publish request: braces, field names, quotes and commas.
+const messageOverhead = 64
+
+// Client calls Pub/Sub with a bearer token. An empty AccessToken sends no
+// Authorization header, as the emulator expects.
+type Client struct {
+	HTTP        *httpclient.Client
+	BaseURL     string // e.g. https://pubsub.googleapis.com
+	AccessToken string
+}
+
+// Message is a Pub/Sub message. Data is base64-encoded on the wire.
+type Message struct {
+	Data        []byte            `json:"data,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+	MessageID   string            `json:"messageId,omitempty"`
+	PublishTime string            `json:"publishTime,omitempty"`
+}
+
+// EncodedSize estimates the bytes the message takes in a publish request,
+// where Data is base64-encoded and so a third larger than its raw size.
+func (m Message) EncodedSize() int {
+	n := base64.StdEncoding.EncodedLen(len(m.Data)) + len(m.OrderingKey) + messageOverhead
+	for key, value := range m.Attributes {
+		n += len(key) + len(value) + 6
+	}
+	return n
+}
+
+// ReceivedMessage is a message returned by Pull with the ID used to
+// acknowledge it.
+type ReceivedMessage struct {
+	AckID           string  `json:"ackId"`
+	Message         Message `json:"message"`
+	DeliveryAttempt int     `json:"deliveryAttempt,omitempty"`
+}
+
+// TopicName returns the full resource name of a topic given by ID or by
+// full name.
+func TopicName(projectID, topic string) string {
+	return resourceName(projectID, "topics", topic)
+}
+
+// SubscriptionName returns the full resource name of a subscription given
+// by ID or by full name.
+func SubscriptionName(projectID, subscription string) string {
+	return resourceName(projectID, "subscriptions", subscription)
+}
+
+func resourceName(projectID, collection, name string) string {
+	if strings.HasPrefix(name, "projects/") {
+		return name
+	}
+	return fmt.Sprintf("projects/%s/%s/%s", projectID, collection, name)
+}
+
+// URL returns the REST URL of a resource or a custom method on it, e.g.
+// URL("projects/p/topics/t", ":publish").
+func (c *Client) URL(name, suffix string) string {
+	return c.BaseURL + "/v1/" + name + suffix
+}
+
+// Publish publishes one batch of messages to topic and returns their IDs.
+func (c *Client) Publish(ctx context.Context, topic string, messages []Message) ([]string, error) {
+	var resp struct {
+		MessageIDs []string `json:"messageIds"`
+	}
+	if err := c.Call(ctx, "POST", c.URL(topic, ":publish"), map[string]interface{}{"messages": messages}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.MessageIDs, nil
+}
+
+// Pull returns up to maxMessages messages from subscription. It may return
+// fewer, or none, even when more are available.
+func (c *Client) Pull(ctx context.Context, subscription string, maxMessages int) ([]ReceivedMessage, error) {
+	var resp struct {
+		ReceivedMessages []ReceivedMessage `json:"receivedMessages"`
+	}
+	if err := c.Call(ctx, "POST", c.URL(subscription, ":pull"), map[string]interface{}{"maxMessages": maxMessages}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ReceivedMessages, nil
+}
+
+// Acknowledge acknowledges messages so they're not redelivered.
+func (c *Client) Acknowledge(ctx context.Context, subscription string, ackIDs []string) error {
+	return c.Call(ctx, "POST", c.URL(subscription, ":acknowledge"), map[string]interface{}{"ackIds": ackIDs}, nil)
+}
+
+// ModifyAckDeadline sets the ack deadline of messages; 0 makes them
+// available for redelivery immediately.
+func (c *Client) ModifyAckDeadline(ctx context.Context, subscription string, ackIDs []string, seconds int) error {
+	return c.Call(ctx, "POST", c.URL(subscription, ":modifyAckDeadline"), map[string]interface{}{
+		"ackIds":             ackIDs,
+		"ackDeadlineSeconds": seconds,
+	}, nil)
+}
+
+// Create creates the topic or subscription name from resource and returns
+// the created resource.
+func (c *Client) Create(ctx context.Context, name string, resource interface{}) (map[string]interface{}, error) {
+	var created map[string]interface{}
+	if err := c.Call(ctx, "PUT", c.URL(name, ""), resource, &created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Get returns the topic or subscription name.
+func (c *Client) Get(ctx context.Context, name string) (map[string]interface{}, error) {
+	var resource map[string]interface{}
+	if err := c.Call(ctx, "GET", c.URL(name, ""), nil, &resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// Delete deletes the topic or subscription name.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	return c.Call(ctx, "DELETE", c.URL(name, ""), nil, nil)
+}
+
+// Duration formats d the way the API expects durations, e.g. "86400s".
+func Duration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
+
+// Call sends request (when non-nil) as JSON and decodes the response into
+// response (when non-nil).
+func (c *Client) Call(ctx context.Context, method, url string, request, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	header := http.Header{}
+	if c.AccessToken != "" {
+		header.Set("Authorization", "Bearer "+c.AccessToken)
+	}
+	header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTP.Do(ctx, method, url, header, body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return apierror.Parse("Pub/Sub", resp.StatusCode, resp.Body)
+	}
+
+	if response != nil && len(resp.Body) > 0 {
+		if err := json.Unmarshal(resp.Body, response); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
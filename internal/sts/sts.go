@@ -0,0 +1,92 @@
+// Package sts exchanges external credentials for Google access tokens with
+// the Security Token Service, using OAuth 2.0 token exchange (RFC 8693).
+package sts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"wif-poc/internal/apierror"
+	"wif-poc/internal/httpclient"
+)
+
+// Subject token types accepted by STS.
+const (
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeSAML2       = "urn:ietf:params:oauth:token-type:saml2"
+	TokenTypeAWS         = "urn:ietf:params:aws:token-type:aws4_request"
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// CloudPlatformScope is the scope requested for federated and service
+// account access tokens.
+const CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+const grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// TokenResponse is the STS token endpoint's response.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Client calls the STS token endpoint.
+type Client struct {
+	HTTP    *httpclient.Client
+	BaseURL string // e.g. https://sts.googleapis.com
+}
+
+// TokenURL returns the token endpoint's URL.
+func (c *Client) TokenURL() string {
+	return c.BaseURL + "/v1/token"
+}
+
+// Exchange posts a token exchange request with the given form fields.
+// grant_type and requested_token_type are filled in when absent.
+func (c *Client) Exchange(ctx context.Context, fields map[string]string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", grantTypeTokenExchange)
+	form.Set("requested_token_type", TokenTypeAccessToken)
+	for key, value := range fields {
+		form.Set(key, value)
+	}
+
+	resp, err := c.HTTP.PostForm(ctx, c.TokenURL(), form)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.Parse("STS", resp.StatusCode, resp.Body)
+	}
+
+	var tokenResp TokenResponse
+	if err := json.Unmarshal(resp.Body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &tokenResp, nil
+}
+
+// WorkloadAudience returns the STS audience of a workload identity pool
+// provider.
+func WorkloadAudience(projectNumber, poolID, providerID string) string {
+	return fmt.Sprintf(
+		"//iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/providers/%s",
+		projectNumber,
+		poolID,
+		providerID,
+	)
+}
+
+// WorkforceAudience returns the STS audience of a workforce pool provider.
+func WorkforceAudience(poolID, providerID string) string {
+	return fmt.Sprintf(
+		"//iam.googleapis.com/locations/global/workforcePools/%s/providers/%s",
+		poolID,
+		providerID,
+	)
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package tokencache
+
+import "os"
+
+// Without flock, parallel jobs that miss the cache at the same time each
+// refresh; the last Put wins.
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package tokencache stores issued tokens on disk, keyed by the identity
+// they were issued for, so repeated runs on one host can reuse a token until
+// shortly before it expires instead of calling STS and IAM again.
+//
+// Each key has its own 0600 file in a 0700 directory, and a lock file that
+// serializes refreshes: when parallel jobs miss the cache at the same time,
+// one refreshes and the others wait and then read its result. Put sweeps
+// the files of expired entries, so the directory doesn't grow with every
+// identity that ever used it.
+package tokencache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Key identifies a cached token.
+type Key struct {
+	Audience       string   `json:"audience"` // pool and provider
+	ServiceAccount string   `json:"service_account,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
+	Subject        string   `json:"subject"`
+	// Variant tells apart tokens of the same identity that differ in
+	// kind or power, e.g. ID tokens or downscoped access tokens.
+	Variant string `json:"variant,omitempty"`
+}
+
+func (k Key) String() string {
+	data, _ := json.Marshal(k)
+	return string(data)
+}
+
+func (k Key) hash() string {
+	sum := sha256.Sum256([]byte(k.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Entry is a cached token.
+type Entry struct {
+	Key       Key       `json:"key"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Cache is a directory of cached tokens.
+type Cache struct {
+	Dir string
+}
+
+// DefaultDir returns the per-user cache directory, e.g. ~/.cache/wif-poc/tokens.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "wif-poc", "tokens")
+}
+
+// Open creates the cache directory if needed and makes sure only the current
+// user can read it.
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict cache directory: %w", err)
+	}
+	return &Cache{Dir: dir}, nil
+}
+
+// Lock takes an exclusive lock on key, blocking until it's available. Hold
+// it across Get, the refresh and Put.
+func (c *Cache) Lock(key Key) (unlock func(), err error) {
+	path := filepath.Join(c.Dir, key.hash()+".lock")
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %w", err)
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock cache entry: %w", err)
+		}
+		// A sweep may have removed the file while we waited for it; the
+		// lock is then on a file nobody else will open, so start over.
+		if current, err := os.Stat(path); err == nil {
+			if locked, err := f.Stat(); err == nil && os.SameFile(current, locked) {
+				return func() {
+					unlockFile(f)
+					f.Close()
+				}, nil
+			}
+		}
+		unlockFile(f)
+		f.Close()
+	}
+}
+
+// Get returns the cached token for key unless it expires within margin.
+func (c *Cache) Get(key Key, margin time.Duration) (*Entry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Token == "" {
+		return nil, false
+	}
+	// Guard against hash collisions and hand-edited files.
+	if entry.Key.String() != key.String() {
+		return nil, false
+	}
+	if time.Until(entry.ExpiresAt) <= margin {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Put stores a token for key, replacing any previous entry atomically.
+func (c *Cache) Put(key Key, token string, expiresAt time.Time) error {
+	data, err := json.Marshal(Entry{Key: key, Token: token, ExpiresAt: expiresAt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.Dir, key.hash()+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp already uses 0600, but be explicit about it.
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to restrict cache file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("failed to replace cache file: %w", err)
+	}
+	c.sweep(key.hash(), time.Now())
+	return nil
+}
+
+// sweep removes the entries that expired before now, and the lock files of
+// refreshes that never stored an entry, skipping the entry named keep and
+// any entry whose lock is held. Failures are ignored; the next sweep
+// retries.
+func (c *Cache) sweep(keep string, now time.Time) {
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		names[file.Name()] = true
+	}
+	for name := range names {
+		hash, ext, ok := strings.Cut(name, ".")
+		if !ok || hash == keep || (ext != "json" && ext != "lock") {
+			continue
+		}
+		if ext == "lock" && names[hash+".json"] {
+			continue // swept along with its entry
+		}
+		if ext == "json" && !c.expired(filepath.Join(c.Dir, name), now) {
+			continue
+		}
+		c.remove(hash)
+	}
+}
+
+// expired reports whether the entry file at path expired before now, or
+// can't be read as an entry at all.
+func (c *Cache) expired(path string, now time.Time) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return true
+	}
+	return entry.ExpiresAt.Before(now)
+}
+
+// remove deletes the entry and lock files of hash, unless another process
+// holds the lock.
+func (c *Cache) remove(hash string) {
+	lockPath := filepath.Join(c.Dir, hash+".lock")
+	f, err := os.OpenFile(lockPath, os.O_RDWR, 0600)
+	if err != nil {
+		os.Remove(filepath.Join(c.Dir, hash+".json"))
+		return
+	}
+	defer f.Close()
+	if locked, err := tryLockFile(f); err != nil || !locked {
+		return
+	}
+	defer unlockFile(f)
+	os.Remove(filepath.Join(c.Dir, hash+".json"))
+	os.Remove(lockPath)
+}
+
+func (c *Cache) path(key Key) string {
+	return filepath.Join(c.Dir, key.hash()+".json")
+}
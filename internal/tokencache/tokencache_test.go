@@ -0,0 +1,259 @@
+package tokencache
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	alice = Key{Audience: "//iam.googleapis.com/pool/provider", Subject: "jwt iss=https://issuer.example.com sub=alice"}
+	bob   = Key{Audience: "//iam.googleapis.com/pool/provider", Subject: "jwt iss=https://issuer.example.com sub=bob"}
+)
+
+func openCache(t *testing.T) *Cache {
+	t.Helper()
+	c, err := Open(filepath.Join(t.TempDir(), "tokens"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func files(t *testing.T, c *Cache) []string {
+	t.Helper()
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGetPut(t *testing.T) {
+	c := openCache(t)
+	if _, ok := c.Get(alice, 0); ok {
+		t.Fatal("Get() hit an empty cache")
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := c.Put(alice, "token-a", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := c.Get(alice, 5*time.Minute)
+	if !ok {
+		t.Fatal("Get() missed a fresh entry")
+	}
+	if entry.Token != "token-a" || !entry.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Get() = %q expiring %s, want %q expiring %s", entry.Token, entry.ExpiresAt, "token-a", expiresAt)
+	}
+	if _, ok := c.Get(bob, 0); ok {
+		t.Error("Get() returned alice's token for bob")
+	}
+
+	if err := c.Put(alice, "token-b", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := c.Get(alice, 0); entry == nil || entry.Token != "token-b" {
+		t.Errorf("Get() after a second Put = %+v, want token-b", entry)
+	}
+}
+
+func TestGetExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		margin time.Duration
+		want   bool
+	}{
+		{"fresh", time.Hour, 5 * time.Minute, true},
+		{"within the margin", 4 * time.Minute, 5 * time.Minute, false},
+		{"expired", -time.Minute, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := openCache(t)
+			if err := c.Put(alice, "token", time.Now().Add(tt.expiry)); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := c.Get(alice, tt.margin); ok != tt.want {
+				t.Errorf("Get() hit = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIgnoresOtherKeys(t *testing.T) {
+	c := openCache(t)
+	// An entry stored under alice's file name but for another key, as a
+	// hash collision or a hand-edited file would leave it.
+	if err := c.Put(bob, "token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(c.path(bob), c.path(alice)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(alice, 0); ok {
+		t.Error("Get() returned an entry stored for another key")
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	c := openCache(t)
+	if err := os.Chmod(c.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Open(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(alice, "token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]os.FileMode{c.Dir: 0700, c.path(alice): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %o, want %o", path, got, want)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no file locks")
+	}
+	c := openCache(t)
+	unlock, err := c.Lock(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := c.Lock(alice)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+
+	// Another key isn't held up.
+	unlockBob, err := c.Lock(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockBob()
+
+	select {
+	case <-locked:
+		t.Fatal("second Lock() returned while the first was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case unlock := <-locked:
+		unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second Lock() didn't return after the first was released")
+	}
+}
+
+func TestPutSweepsExpiredEntries(t *testing.T) {
+	c := openCache(t)
+	carol := Key{Audience: alice.Audience, Subject: "jwt iss=https://issuer.example.com sub=carol"}
+	dave := Key{Audience: alice.Audience, Subject: "jwt iss=https://issuer.example.com sub=dave"}
+
+	// alice's entry expired, and nobody holds its lock.
+	unlock, err := c.Lock(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(alice, "token", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	// carol's refresh failed, leaving only a lock file.
+	unlock, err = c.Lock(carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	// dave's entry expired too, but a refresh holds its lock.
+	unlockDave, err := c.Lock(dave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockDave()
+	if err := c.Put(dave, "token", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put(bob, "token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{bob.hash() + ".json", dave.hash() + ".json", dave.hash() + ".lock"}
+	if runtime.GOOS == "windows" {
+		// Without locks, dave's entry can't be told apart from alice's.
+		want = []string{bob.hash() + ".json"}
+	}
+	sort.Strings(want)
+	got := files(t, c)
+	if len(got) != len(want) {
+		t.Fatalf("files after Put = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("files after Put = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestLockAfterSweep(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no file locks")
+	}
+	c := openCache(t)
+	unlock, err := c.Lock(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := c.Lock(alice)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// A sweep removes alice's lock file while the goroutine waits on it.
+	if err := os.Remove(filepath.Join(c.Dir, alice.hash()+".lock")); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	unlockWaiter := <-locked
+	defer unlockWaiter()
+	if _, err := os.Stat(filepath.Join(c.Dir, alice.hash()+".lock")); err != nil {
+		t.Errorf("the waiter holds a lock on a removed file: %v", err)
+	}
+}